@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Solidsilver/merkle/mtree"
+	"github.com/Solidsilver/merkle/verify"
+	pb "github.com/schollz/progressbar/v3"
+)
+
+// downloader fetches a single file from cmd/serve,
+// verifying every chunk against a trusted root hash.
+type downloader struct {
+	client   *http.Client
+	server   string
+	fileName string
+	root     []byte
+	hasher   mtree.Hasher
+
+	tree *mtree.Tree
+	hdr  mtree.Header
+	// Records verified leaves so the download can be resumed
+	bitmap *leafBitmap
+}
+
+func (d *downloader) fileURL(endpoint string) string {
+	return d.server + "/" + endpoint + "/" + url.PathEscape(d.fileName)
+}
+
+// fetchTree downloads the file's Merkle tree from /getMerkle.
+// Individual chunks are checked against the trusted root with
+// proofs, so the tree itself does not need to be trusted, but
+// it is rejected early if its root does not match.
+func (d *downloader) fetchTree() error {
+	response, err := d.client.Get(d.fileURL("getMerkle"))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching tree: %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	tree, hdr, err := mtree.Decode(body)
+	if err != nil {
+		return fmt.Errorf("decoding tree: %w", err)
+	}
+	if hdr.Version == 0 {
+		return errors.New("server sent a legacy tree without a chunk size or length")
+	}
+	if hdr.Leaves > 0 && (hdr.ChunkSize == 0 || hdr.Length == 0) {
+		return errors.New("server sent a tree without a chunk size or length")
+	}
+	if !hdr.Hasher.DomainSeparated {
+		return errors.New("server tree is not domain separated and cannot be verified safely, start the server with -ds")
+	}
+	if hdr.Hasher != d.hasher {
+		return fmt.Errorf("server tree uses %s (domain separated: %t), expected %s (domain separated: %t)",
+			hdr.Hasher.Algorithm, hdr.Hasher.DomainSeparated, d.hasher.Algorithm, d.hasher.DomainSeparated)
+	}
+	if !bytes.Equal(tree.RootHash(), d.root) {
+		return errors.New("server tree does not match the trusted root")
+	}
+	d.tree = tree
+	d.hdr = hdr
+	return nil
+}
+
+// fetchRange downloads the bytes of the given leaves from /getFile.
+func (d *downloader) fetchRange(leaves mtree.LeafRange) ([]byte, error) {
+	start, end := leaves.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+	request, err := http.NewRequest("GET", d.fileURL("getFile"), nil)
+	if err != nil {
+		return nil, err
+	}
+	// The end of an HTTP byte range is inclusive
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	// cmd/serve uses the root hash as the ETag, so a file that has
+	// changed on the server fails fast instead of failing verification
+	request.Header.Set("If-Match", `"`+hex.EncodeToString(d.root)+`"`)
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	// A server may ignore the range and send the whole file
+	if response.StatusCode == http.StatusOK && int64(len(body)) == d.hdr.Length {
+		body = body[start:end]
+	} else if response.StatusCode == http.StatusPreconditionFailed {
+		return nil, errors.New("file has changed on the server")
+	} else if response.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("fetching bytes %d-%d: %s: %s", start, end, response.Status, bytes.TrimSpace(body))
+	}
+	if int64(len(body)) != end-start {
+		return nil, fmt.Errorf("fetching bytes %d-%d: got %d bytes", start, end, len(body))
+	}
+	return body, nil
+}
+
+// verifyRange checks every chunk of data against the trusted
+// root, where data holds the bytes of the given leaves.
+func (d *downloader) verifyRange(leaves mtree.LeafRange, data []byte) error {
+	return d.tree.VerifyRange(d.root, leaves, data)
+}
+
+// download fetches, verifies and writes the given leaves into out.
+// Ranges are split into requests of span leaves, which are fetched
+// concurrently over conns connections. A request that fails or does
+// not verify is retried on its own up to retries more times.
+func (d *downloader) download(out *os.File, ranges []mtree.LeafRange, span, conns, retries int) error {
+	total := int64(0)
+	for _, lr := range ranges {
+		start, end := lr.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+		total += end - start
+	}
+	bar := pb.NewOptions64(total,
+		pb.OptionSetDescription("downloading"),
+		pb.OptionShowBytes(true),
+		pb.OptionShowElapsedTimeOnFinish(),
+		pb.OptionSetPredictTime(true),
+	)
+
+	jobs := make(chan mtree.LeafRange, conns)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var errs []error
+
+	wg.Add(conns)
+	for range conns {
+		go func() {
+			defer wg.Done()
+			for leaves := range jobs {
+				err := d.fetchWithRetry(out, leaves, retries)
+				if err != nil {
+					errMu.Lock()
+					errs = append(errs, err)
+					errMu.Unlock()
+					continue
+				}
+				start, end := leaves.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+				bar.Add64(end - start)
+			}
+		}()
+	}
+	for _, lr := range ranges {
+		for start := lr.Start; start < lr.End; start += span {
+			jobs <- mtree.LeafRange{Start: start, End: min(start+span, lr.End)}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// fetchWithRetry fetches, verifies and writes a single range of leaves,
+// retrying with a growing delay when any of those steps fail.
+func (d *downloader) fetchWithRetry(out *os.File, leaves mtree.LeafRange, retries int) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		if err = d.fetchAndWrite(out, leaves); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("chunks %d-%d failed after %d attempts: %w", leaves.Start, leaves.End-1, retries+1, err)
+}
+
+func (d *downloader) fetchAndWrite(out *os.File, leaves mtree.LeafRange) error {
+	data, err := d.fetchRange(leaves)
+	if err != nil {
+		return err
+	}
+	if err := d.verifyRange(leaves, data); err != nil {
+		return err
+	}
+	offset, _ := leaves.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+	if _, err := out.WriteAt(data, offset); err != nil {
+		return err
+	}
+	if d.bitmap != nil {
+		return d.bitmap.set(leaves)
+	}
+	return nil
+}
+
+// staleRanges hashes the local file at path and returns the
+// ranges of leaves that do not match the server's tree.
+func (d *downloader) staleRanges(path string) ([]mtree.LeafRange, error) {
+	local, err := verify.HashFileHarr(path, d.hdr.ChunkSize, verify.WithHasher(d.hasher))
+	if err != nil {
+		return nil, err
+	}
+	return mtree.Diff(local, d.tree), nil
+}
+
+// matchesRoot rehashes the file at path and
+// checks it against the trusted root.
+func (d *downloader) matchesRoot(path string) (bool, error) {
+	tree, err := verify.HashFileHarr(path, d.hdr.ChunkSize, verify.WithHasher(d.hasher))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(tree.RootHash(), d.root), nil
+}
+
+// finalize rehashes the downloaded file and only moves
+// it to outPath if its root matches the trusted root.
+func (d *downloader) finalize(partPath, outPath string) error {
+	ok, err := d.matchesRoot(partPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("downloaded file does not match the trusted root, leaving it at %s", partPath)
+	}
+	return os.Rename(partPath, outPath)
+}
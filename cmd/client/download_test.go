@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+	"github.com/Solidsilver/merkle/verify"
+)
+
+const testChunkSize = 64
+
+// testServer serves a single file named "file" the way cmd/serve does.
+type testServer struct {
+	*httptest.Server
+	data []byte
+	tree *mtree.Tree
+	// corrupt is applied to the bytes of every range before they are sent
+	corrupt func(start int64, body []byte)
+	// fetched counts the bytes of file data sent
+	fetched atomic.Int64
+}
+
+func newTestServer(t *testing.T, h mtree.Hasher, data []byte) *testServer {
+	t.Helper()
+	tree, err := verify.HashReader(bytes.NewReader(data), testChunkSize, verify.WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &testServer{data: data, tree: tree}
+	router := http.NewServeMux()
+	router.HandleFunc("GET /getMerkle/file", func(respW http.ResponseWriter, req *http.Request) {
+		respW.Write(srv.tree.Encode())
+	})
+	router.HandleFunc("GET /getFile/file", func(respW http.ResponseWriter, req *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(respW, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// cmd/serve uses the root hash as the ETag
+		if ifMatch := req.Header.Get("If-Match"); ifMatch != "" && ifMatch != `"`+hex.EncodeToString(srv.tree.RootHash())+`"` {
+			respW.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		// The end of an HTTP byte range is inclusive
+		body := bytes.Clone(srv.data[start : end+1])
+		if srv.corrupt != nil {
+			srv.corrupt(start, body)
+		}
+		srv.fetched.Add(int64(len(body)))
+		respW.WriteHeader(http.StatusPartialContent)
+		respW.Write(body)
+	})
+	srv.Server = httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *testServer) downloader(h mtree.Hasher) *downloader {
+	return &downloader{
+		client:   srv.Client(),
+		server:   srv.URL,
+		fileName: "file",
+		root:     srv.tree.RootHash(),
+		hasher:   h,
+	}
+}
+
+// downloadTo downloads the whole file to path as main does.
+func (d *downloader) downloadTo(path string, span, conns, retries int) error {
+	partPath := path + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := out.Truncate(d.hdr.Length); err != nil {
+		return err
+	}
+	if err := d.download(out, []mtree.LeafRange{{Start: 0, End: d.hdr.Leaves}}, span, conns, retries); err != nil {
+		return err
+	}
+	return d.finalize(partPath, path)
+}
+
+func TestDownload(t *testing.T) {
+	for _, size := range merkletest.Sizes(testChunkSize) {
+		if size == 0 {
+			// Empty files have no tree to download
+			continue
+		}
+		srv := newTestServer(t, mtree.DomainSeparated, merkletest.Data(size))
+		d := srv.downloader(mtree.DomainSeparated)
+		if err := d.fetchTree(); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "file")
+		if err := d.downloadTo(path, 3, 4, 0); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, srv.data) {
+			t.Errorf("%d bytes: downloaded file differs: %v", size, err)
+		}
+	}
+}
+
+func TestDownloadRejectsTamperedData(t *testing.T) {
+	srv := newTestServer(t, mtree.DomainSeparated, merkletest.Data(5*testChunkSize+3))
+	srv.corrupt = func(start int64, body []byte) {
+		if offset := 3*testChunkSize + 10 - start; offset >= 0 && offset < int64(len(body)) {
+			body[offset] ^= 1
+		}
+	}
+	d := srv.downloader(mtree.DomainSeparated)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	if err := d.downloadTo(path, 2, 4, 0); err == nil {
+		t.Error("download of tampered data succeeded")
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("tampered download was saved")
+	}
+}
+
+// TestDownloadRetries checks that a range that fails verification
+// once is fetched again, and only fails the download without retries.
+func TestDownloadRetries(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		srv := newTestServer(t, mtree.DomainSeparated, merkletest.Data(8*testChunkSize))
+		var corrupted atomic.Bool
+		srv.corrupt = func(start int64, body []byte) {
+			if start == 2*testChunkSize && !corrupted.Swap(true) {
+				body[0] ^= 1
+			}
+		}
+		d := srv.downloader(mtree.DomainSeparated)
+		if err := d.fetchTree(); err != nil {
+			t.Fatal(err)
+		}
+		err := d.downloadTo(filepath.Join(t.TempDir(), "file"), 2, 3, retries)
+		if retries == 0 && err == nil {
+			t.Error("download succeeded without retrying a corrupted range")
+		}
+		if retries > 0 && err != nil {
+			t.Errorf("download with retries failed: %v", err)
+		}
+	}
+}
+
+// TestDownloadChangedFile checks that a file that changes on the server
+// after its tree was fetched fails the download before verification.
+func TestDownloadChangedFile(t *testing.T) {
+	srv := newTestServer(t, mtree.DomainSeparated, merkletest.Data(5*testChunkSize))
+	d := srv.downloader(mtree.DomainSeparated)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	changed := newTestServer(t, mtree.DomainSeparated, merkletest.Data(6*testChunkSize))
+	srv.data, srv.tree = changed.data, changed.tree
+	err := d.downloadTo(filepath.Join(t.TempDir(), "file"), 2, 3, 0)
+	if err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("download of a changed file returned %v", err)
+	}
+	if srv.fetched.Load() != 0 {
+		t.Errorf("%d bytes of the changed file were sent", srv.fetched.Load())
+	}
+}
+
+func TestFetchTreeRejectsMismatches(t *testing.T) {
+	srv := newTestServer(t, mtree.DomainSeparated, merkletest.Data(5*testChunkSize))
+	d := srv.downloader(mtree.DomainSeparated)
+	d.root = mtree.DomainSeparated.Leaf(nil)
+	if err := d.fetchTree(); err == nil {
+		t.Error("fetchTree accepted a tree with the wrong root")
+	}
+	d = srv.downloader(mtree.Hasher{Algorithm: mtree.BLAKE2b_256, DomainSeparated: true})
+	if err := d.fetchTree(); err == nil {
+		t.Error("fetchTree accepted a tree with the wrong hasher")
+	}
+	srv = newTestServer(t, mtree.Legacy, merkletest.Data(5*testChunkSize))
+	if err := srv.downloader(mtree.Legacy).fetchTree(); err == nil {
+		t.Error("fetchTree accepted a tree without domain separation")
+	}
+	srv = newTestServer(t, mtree.DomainSeparated, merkletest.Data(5*testChunkSize))
+	srv.tree.ChunkSize, srv.tree.Length = 0, 0
+	if err := srv.downloader(mtree.DomainSeparated).fetchTree(); err == nil {
+		t.Error("fetchTree accepted a tree without a chunk size or length")
+	}
+}
@@ -2,36 +2,102 @@ package main
 
 import (
 	"encoding/base64"
+	"flag"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/Solidsilver/merkle/mtree"
 )
 
 func main() {
-	client := new(http.Client)
-
-	request, err := http.NewRequest("GET", "http://localhost:8039/getHash", nil)
+	server := flag.String("s", "http://localhost:8039", "Address of the server")
+	fileName := flag.String("f", "", "Name of the file to download")
+	outPath := flag.String("o", "", "Where to save the file. Defaults to the file name")
+	rootFlag := flag.String("root", "", "Trusted root hash of the file (base64)")
+	span := flag.Int("span", 64, "Number of chunks to fetch per request")
+	conns := flag.Int("c", 4, "Number of concurrent connections")
+	retries := flag.Int("retries", 3, "How many times to retry a failed request")
+	algName := flag.String("alg", "sha256", "Hash algorithm the server uses")
+	syncFlag := flag.Bool("sync", false, "Update an existing copy of the file at -o in place, only downloading the parts that differ")
+	flag.Parse()
+	if *fileName == "" || *rootFlag == "" {
+		log.Fatal("You must pass a file and its trusted root `<cmd> -f <file> -root <hash>`")
+	}
+	if *span < 1 || *conns < 1 {
+		log.Fatal("-span and -c must be at least 1")
+	}
+	if *outPath == "" {
+		*outPath = filepath.Base(*fileName)
+	}
+	root, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(*rootFlag, "="))
 	if err != nil {
-		fmt.Println("Got err:", err.Error())
-		return
+		log.Fatal("Invalid root hash: ", err.Error())
+	}
+	alg, err := mtree.ParseAlgorithm(*algName)
+	if err != nil {
+		log.Fatal(err)
 	}
-	// request.Header.Add("Accept-Encoding", "gzip")
 
-	response, err := client.Do(request)
-	defer response.Body.Close()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *conns
+	d := &downloader{
+		client:   &http.Client{Transport: transport},
+		server:   strings.TrimRight(*server, "/"),
+		fileName: *fileName,
+		root:     root,
+		// Without domain separation a server could pass off the
+		// children of an interior node as the contents of a leaf,
+		// forging a file that verifies against the trusted root
+		hasher: mtree.Hasher{Algorithm: alg, DomainSeparated: true},
+	}
+	if err := d.fetchTree(); err != nil {
+		log.Fatal(err)
+	}
+	if *syncFlag {
+		if err := d.sync(*outPath, *span, *conns, *retries); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("\nVerified and synced", *outPath)
+		return
+	}
+	fmt.Printf("Downloading %d bytes in %d chunks\n", d.hdr.Length, d.hdr.Leaves)
 
-	bytes, err := io.ReadAll(response.Body)
+	partPath := *outPath + ".part"
+	bitmapPath := partPath + ".leaves"
+	bitmap, resuming, err := openBitmap(bitmapPath, d.root, d.hdr.Leaves)
 	if err != nil {
-		fmt.Println("Got err:", err.Error())
-		return
+		log.Fatal(err)
 	}
-	fmt.Println("Got hash:\n", base64.RawStdEncoding.EncodeToString(bytes))
-	mt, err := mtree.FromArray(bytes)
+	d.bitmap = bitmap
+	out, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
-		fmt.Println("Error deserializing array:", err.Error())
-		return
+		log.Fatal(err)
+	}
+	if err := out.Truncate(d.hdr.Length); err != nil {
+		log.Fatal(err)
+	}
+	ranges := []mtree.LeafRange{{Start: 0, End: d.hdr.Leaves}}
+	if resuming {
+		ranges, err = d.resumeRanges(partPath, d.bitmap)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = d.download(out, ranges, *span, *conns, *retries)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatal(err, "\nRun the same command again to resume the download")
+	}
+	if err := d.finalize(partPath, *outPath); err != nil {
+		log.Fatal(err)
 	}
-	fmt.Println("Constructed tree:\n", mt.String())
+	d.bitmap.close()
+	os.Remove(bitmapPath)
+	fmt.Println("\nVerified and saved", *outPath)
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"sync"
+
+	"github.com/Solidsilver/merkle/mtree"
+	"github.com/Solidsilver/merkle/verify"
+)
+
+// leafBitmap is a sidecar file next to a partial download
+// recording which leaves have been verified and written.
+// It starts with the trusted root and leaf count, so a bitmap
+// left behind by a different download is never reused.
+type leafBitmap struct {
+	mu     sync.Mutex
+	file   *os.File
+	header int
+	bits   []byte
+}
+
+// openBitmap opens the bitmap at path, or creates an empty one if it
+// does not exist or belongs to a different download. The returned
+// bool reports whether an existing bitmap was loaded.
+func openBitmap(path string, root []byte, leaves int) (*leafBitmap, bool, error) {
+	header := binary.BigEndian.AppendUint64(append([]byte{}, root...), uint64(leaves))
+	bm := &leafBitmap{
+		header: len(header),
+		bits:   make([]byte, (leaves+7)/8),
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	loaded := len(existing) == len(header)+len(bm.bits) && bytes.HasPrefix(existing, header)
+	if loaded {
+		copy(bm.bits, existing[len(header):])
+	}
+	bm.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+	if !loaded {
+		if err := bm.file.Truncate(0); err != nil {
+			return nil, false, err
+		}
+		if _, err := bm.file.WriteAt(append(header, bm.bits...), 0); err != nil {
+			return nil, false, err
+		}
+	}
+	return bm, loaded, nil
+}
+
+// set marks the given leaves as verified and persists the change.
+func (bm *leafBitmap) set(leaves mtree.LeafRange) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for idx := leaves.Start; idx < leaves.End; idx++ {
+		bm.bits[idx/8] |= 1 << (idx % 8)
+	}
+	first, last := leaves.Start/8, (leaves.End-1)/8
+	_, err := bm.file.WriteAt(bm.bits[first:last+1], int64(bm.header+first))
+	return err
+}
+
+// reset replaces the bitmap so only leaves outside of the given ranges are set.
+func (bm *leafBitmap) reset(missing []mtree.LeafRange, leaves int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	clear(bm.bits)
+	for idx := 0; idx < leaves; idx++ {
+		bm.bits[idx/8] |= 1 << (idx % 8)
+	}
+	for _, lr := range missing {
+		for idx := lr.Start; idx < lr.End; idx++ {
+			bm.bits[idx/8] &^= 1 << (idx % 8)
+		}
+	}
+	_, err := bm.file.WriteAt(bm.bits, int64(bm.header))
+	return err
+}
+
+// count returns the number of leaves marked as verified.
+func (bm *leafBitmap) count() int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	count := 0
+	for _, b := range bm.bits {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
+// isSet reports whether the leaf at idx is marked as verified.
+func (bm *leafBitmap) isSet(idx int) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.bits[idx/8]&(1<<(idx%8)) != 0
+}
+
+func (bm *leafBitmap) close() error {
+	return bm.file.Close()
+}
+
+// resumeRanges returns the ranges of leaves of a partial download
+// that still have to be fetched. Every run of leaves the bitmap marks
+// as verified is rehashed with the verify package and checked against
+// the server's tree, in case a chunk was only partly written or the
+// partial file was modified since, and every other leaf is fetched.
+// The bitmap is then rewritten to match.
+func (d *downloader) resumeRanges(partPath string, bm *leafBitmap) ([]mtree.LeafRange, error) {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+	leafHashes := d.tree.LeafHashes()
+	missing := []mtree.LeafRange{}
+	invalid := 0
+	for idx := 0; idx < d.hdr.Leaves; {
+		if !bm.isSet(idx) {
+			missing = appendLeaf(missing, idx)
+			idx++
+			continue
+		}
+		run := mtree.LeafRange{Start: idx, End: idx + 1}
+		for run.End < d.hdr.Leaves && bm.isSet(run.End) {
+			run.End++
+		}
+		start, end := run.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+		local, err := verify.HashReaderAt(io.NewSectionReader(part, start, end-start), end-start,
+			d.hdr.ChunkSize, verify.WithHasher(d.hasher))
+		if err != nil {
+			return nil, err
+		}
+		for offset, leafHash := range local.LeafHashes() {
+			if !bytes.Equal(leafHash, leafHashes[run.Start+offset]) {
+				missing = appendLeaf(missing, run.Start+offset)
+				invalid++
+			}
+		}
+		idx = run.End
+	}
+	if err := bm.reset(missing, d.hdr.Leaves); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nResuming: %d of %d chunks already downloaded", bm.count(), d.hdr.Leaves)
+	if invalid > 0 {
+		fmt.Printf(", %d recorded chunks were invalid", invalid)
+	}
+	fmt.Println()
+	return missing, nil
+}
+
+// appendLeaf appends the leaf at idx to ranges,
+// merging it with the last range if they are adjacent.
+func appendLeaf(ranges []mtree.LeafRange, idx int) []mtree.LeafRange {
+	if last := len(ranges) - 1; last >= 0 && ranges[last].End == idx {
+		ranges[last].End++
+		return ranges
+	}
+	return append(ranges, mtree.LeafRange{Start: idx, End: idx + 1})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestBitmapPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.part.leaves")
+	root := mtree.DomainSeparated.Leaf([]byte("root"))
+	bm, loaded, err := openBitmap(path, root, 20)
+	if err != nil || loaded {
+		t.Fatalf("openBitmap of a new bitmap = %t, %v", loaded, err)
+	}
+	for _, lr := range []mtree.LeafRange{{Start: 0, End: 3}, {Start: 7, End: 17}} {
+		if err := bm.set(lr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bm.close()
+
+	bm, loaded, err = openBitmap(path, root, 20)
+	if err != nil || !loaded {
+		t.Fatalf("openBitmap of an existing bitmap = %t, %v", loaded, err)
+	}
+	if got := bm.count(); got != 13 {
+		t.Errorf("reopened bitmap has %d leaves set, want 13", got)
+	}
+	bm.close()
+
+	// A bitmap left behind by a different download is discarded
+	bm, loaded, err = openBitmap(path, mtree.DomainSeparated.Leaf([]byte("other")), 20)
+	if err != nil || loaded || bm.count() != 0 {
+		t.Errorf("openBitmap for another root = %t, %d leaves set, %v", loaded, bm.count(), err)
+	}
+	bm.close()
+}
+
+// TestResume interrupts a download, damages a chunk that was already
+// written, and checks that resuming only fetches what is missing.
+func TestResume(t *testing.T) {
+	h := mtree.DomainSeparated
+	srv := newTestServer(t, h, merkletest.Data(8*testChunkSize-5))
+	srv.corrupt = func(start int64, body []byte) {
+		if start == 5*testChunkSize {
+			body[0] ^= 1
+		}
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	partPath, bitmapPath := path+".part", path+".part.leaves"
+
+	d := srv.downloader(h)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	bm, _, err := openBitmap(bitmapPath, d.root, d.hdr.Leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.bitmap = bm
+	out, err := os.Create(partPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Truncate(d.hdr.Length); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.download(out, []mtree.LeafRange{{Start: 0, End: d.hdr.Leaves}}, 1, 1, 0); err == nil {
+		t.Fatal("download of a corrupted chunk succeeded")
+	}
+	// Only half of chunk 2 made it to disk
+	if _, err := out.WriteAt(make([]byte, testChunkSize/2), 2*testChunkSize+testChunkSize/2); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	bm.close()
+
+	srv.corrupt = nil
+	d = srv.downloader(h)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	bm, loaded, err := openBitmap(bitmapPath, d.root, d.hdr.Leaves)
+	if err != nil || !loaded {
+		t.Fatalf("openBitmap = %t, %v", loaded, err)
+	}
+	defer bm.close()
+	d.bitmap = bm
+	missing, err := d.resumeRanges(partPath, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mtree.LeafRange{{Start: 2, End: 3}, {Start: 5, End: 6}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("resumeRanges() = %v, want %v", missing, want)
+	}
+	if got := bm.count(); got != d.hdr.Leaves-2 {
+		t.Errorf("bitmap has %d leaves set after resuming, want %d", got, d.hdr.Leaves-2)
+	}
+
+	out, err = os.OpenFile(partPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := d.download(out, missing, 1, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.finalize(partPath, path); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, srv.data) {
+		t.Errorf("resumed download differs from the file: %v", err)
+	}
+}
+
+// TestResumeRangesRehashes checks that leaves the bitmap marks as
+// verified are rehashed, so chunks that were only partly written
+// are fetched again, and that unmarked leaves are always fetched.
+func TestResumeRangesRehashes(t *testing.T) {
+	h := mtree.DomainSeparated
+	srv := newTestServer(t, h, merkletest.Data(10*testChunkSize-7))
+	d := srv.downloader(h)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file.part")
+	part := bytes.Clone(srv.data)
+	// Chunk 3 and the short final chunk were cut off while being written
+	clear(part[4*testChunkSize-10 : 4*testChunkSize])
+	clear(part[9*testChunkSize+1:])
+	if err := os.WriteFile(path, part, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bm, _, err := openBitmap(path+".leaves", d.root, d.hdr.Leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bm.close()
+	// Leaf 6 holds the right data but was never marked as verified
+	for _, lr := range []mtree.LeafRange{{Start: 0, End: 6}, {Start: 7, End: 10}} {
+		if err := bm.set(lr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing, err := d.resumeRanges(path, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mtree.LeafRange{{Start: 3, End: 4}, {Start: 6, End: 7}, {Start: 9, End: 10}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("resumeRanges() = %v, want %v", missing, want)
+	}
+	if got := bm.count(); got != d.hdr.Leaves-3 {
+		t.Errorf("bitmap has %d leaves set after resuming, want %d", got, d.hdr.Leaves-3)
+	}
+}
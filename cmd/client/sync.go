@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// sync brings a stale local copy of the file up to date in place.
+// The local file is hashed and compared with the server's tree, and
+// only the byte ranges of differing leaves are downloaded. The file
+// is resized to match the server first, so leaves past the end of a
+// shorter copy are fetched and extra bytes of a longer one are dropped.
+func (d *downloader) sync(localPath string, span, conns, retries int) error {
+	local, err := os.OpenFile(localPath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	if err := local.Truncate(d.hdr.Length); err != nil {
+		return err
+	}
+	stale, err := d.staleRanges(localPath)
+	if err != nil {
+		return err
+	}
+	staleBytes := int64(0)
+	for _, lr := range stale {
+		start, end := lr.ByteRange(d.hdr.ChunkSize, d.hdr.Length)
+		staleBytes += end - start
+	}
+	fmt.Printf("\n%d of %d bytes differ in %d ranges\n", staleBytes, d.hdr.Length, len(stale))
+	if len(stale) > 0 {
+		if err := d.download(local, stale, span, conns, retries); err != nil {
+			return err
+		}
+	}
+	if err := local.Sync(); err != nil {
+		return err
+	}
+	ok, err := d.matchesRoot(localPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s does not match the trusted root after syncing", localPath)
+	}
+	return nil
+}
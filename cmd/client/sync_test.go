@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestSync(t *testing.T) {
+	data := merkletest.Data(8*testChunkSize - 5)
+	changed := bytes.Clone(data)
+	changed[testChunkSize+3] ^= 1
+	changed[6*testChunkSize] ^= 1
+	tests := []struct {
+		name  string
+		local []byte
+		// Number of bytes that have to be downloaded
+		fetched int64
+	}{
+		{"up to date", data, 0},
+		{"two chunks changed", changed, 2 * testChunkSize},
+		{"truncated", data[:3*testChunkSize+10], int64(len(data)) - 3*testChunkSize},
+		{"extended", append(bytes.Clone(data), "more data"...), 0},
+	}
+	for _, test := range tests {
+		srv := newTestServer(t, mtree.DomainSeparated, data)
+		d := srv.downloader(mtree.DomainSeparated)
+		if err := d.fetchTree(); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(path, test.local, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.sync(path, 2, 2, 0); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: synced file differs: %v", test.name, err)
+		}
+		if got := srv.fetched.Load(); got != test.fetched {
+			t.Errorf("%s: downloaded %d bytes, want %d", test.name, got, test.fetched)
+		}
+	}
+}
+
+func TestSyncRejectsTamperedData(t *testing.T) {
+	data := merkletest.Data(4 * testChunkSize)
+	srv := newTestServer(t, mtree.DomainSeparated, data)
+	srv.corrupt = func(start int64, body []byte) { body[0] ^= 1 }
+	d := srv.downloader(mtree.DomainSeparated)
+	if err := d.fetchTree(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	stale := bytes.Clone(data)
+	stale[0] ^= 1
+	if err := os.WriteFile(path, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.sync(path, 2, 2, 0); err == nil {
+		t.Error("sync with tampered data succeeded")
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, stale) {
+		t.Error("sync wrote tampered data to the local file")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Solidsilver/merkle/mtree"
+	"github.com/Solidsilver/merkle/verify"
+)
+
+// treeCache computes the Merkle tree of each served file once and
+// reuses it until the file's size or modification time changes.
+// Trees are also persisted to dir (if set) so they survive restarts.
+type treeCache struct {
+	mu        sync.Mutex
+	dir       string
+	chunkSize int
+	hasher    mtree.Hasher
+	entries   map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	size    int64
+	modTime time.Time
+	// ready is closed once tree and err have been set,
+	// so concurrent requests for a file only hash it once
+	ready chan struct{}
+	tree  *mtree.Tree
+	err   error
+}
+
+func newTreeCache(dir string, chunkSize int, hasher mtree.Hasher) (*treeCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &treeCache{
+		dir:       dir,
+		chunkSize: chunkSize,
+		hasher:    hasher,
+		entries:   map[string]*cacheEntry{},
+	}, nil
+}
+
+func (e *cacheEntry) matches(stat os.FileInfo) bool {
+	return e.size == stat.Size() && e.modTime.Equal(stat.ModTime())
+}
+
+// get returns the tree of the file at filePath along with the file's info,
+// hashing the file if it has not been seen before or has changed since.
+// The returned tree is shared and must not be modified.
+func (c *treeCache) get(filePath string) (*mtree.Tree, os.FileInfo, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.entries, filePath)
+		c.mu.Unlock()
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[filePath]
+	if ok && entry.matches(stat) && !entry.failed() {
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.tree, stat, entry.err
+	}
+	entry = &cacheEntry{
+		size:    stat.Size(),
+		modTime: stat.ModTime(),
+		ready:   make(chan struct{}),
+	}
+	c.entries[filePath] = entry
+	c.mu.Unlock()
+
+	entry.tree, entry.err = c.load(filePath, stat)
+	close(entry.ready)
+	return entry.tree, stat, entry.err
+}
+
+// done reports whether hashing has finished.
+func (e *cacheEntry) done() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// failed reports whether hashing has finished with an error,
+// in which case the next request tries again.
+func (e *cacheEntry) failed() bool {
+	return e.done() && e.err != nil
+}
+
+// find returns the file among filePaths whose tree has the given
+// root hash, along with its tree and info. Only files that have
+// already been hashed are checked, so looking up an unknown root
+// never hashes anything; -warm and the watcher hash files ahead of
+// time. The returned tree is nil if no file matches.
+func (c *treeCache) find(root []byte, filePaths []string) (string, *mtree.Tree, os.FileInfo) {
+	for _, filePath := range filePaths {
+		stat, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		entry, ok := c.entries[filePath]
+		c.mu.Unlock()
+		if !ok || !entry.matches(stat) || !entry.done() {
+			continue
+		}
+		if entry.err == nil && bytes.Equal(entry.tree.RootHash(), root) {
+			return filePath, entry.tree, stat
+		}
+	}
+	return "", nil, nil
+}
+
+// refresh rehashes the file at filePath in the background if it
+// has changed since it was last hashed.
+func (c *treeCache) refresh(filePath string) {
+	go func() {
+		if _, _, err := c.get(filePath); err != nil {
+			fmt.Printf("Failed to hash %s: %s\n", filePath, err.Error())
+		}
+	}()
+}
+
+// forget drops the tree of a file that has been removed,
+// including its persisted copy.
+func (c *treeCache) forget(filePath string) {
+	c.mu.Lock()
+	delete(c.entries, filePath)
+	c.mu.Unlock()
+	if cachePath := c.cachePath(filePath); cachePath != "" {
+		os.Remove(cachePath)
+	}
+}
+
+// fileStatus is the JSON body returned by /status.
+// Root is only set once the file has been hashed.
+type fileStatus struct {
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Root    []byte    `json:"root,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Hashing states reported by /status
+const (
+	statePending = "pending"
+	stateHashing = "hashing"
+	stateReady   = "ready"
+	stateFailed  = "failed"
+)
+
+// status reports whether the tree of the file at filePath is up to date,
+// without hashing the file.
+func (c *treeCache) status(filePath string) (*fileStatus, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	status := &fileStatus{
+		Name:    filepath.Base(filePath),
+		State:   statePending,
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[filePath]
+	c.mu.Unlock()
+	if !ok || !entry.matches(stat) {
+		return status, nil
+	}
+	if !entry.done() {
+		status.State = stateHashing
+		return status, nil
+	}
+	if entry.err != nil {
+		status.State = stateFailed
+		status.Error = entry.err.Error()
+		return status, nil
+	}
+	status.State = stateReady
+	status.Root = entry.tree.RootHash()
+	return status, nil
+}
+
+// load reads the file's tree from the cache directory,
+// or hashes the file and saves its tree there.
+func (c *treeCache) load(filePath string, stat os.FileInfo) (*mtree.Tree, error) {
+	cachePath := c.cachePath(filePath)
+	if cachePath != "" {
+		tree, err := c.readCached(cachePath, stat)
+		if err == nil {
+			fmt.Println("Loaded cached tree for", filePath)
+			return tree, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Ignoring cached tree for %s: %s\n", filePath, err.Error())
+		}
+	}
+	tree, err := verify.HashFileHarr(filePath, c.chunkSize, verify.WithHasher(c.hasher))
+	if err != nil {
+		return nil, err
+	}
+	if cachePath != "" {
+		if err := c.writeCached(cachePath, tree, stat); err != nil {
+			fmt.Printf("Failed to cache tree for %s: %s\n", filePath, err.Error())
+		}
+	}
+	return tree, nil
+}
+
+// cachePath returns where the tree for filePath is persisted,
+// or an empty string if trees are only cached in memory.
+func (c *treeCache) cachePath(filePath string) string {
+	if c.dir == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	sum := sha256.Sum256([]byte(filePath))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".mtree")
+}
+
+// cacheVersion changes whenever the same file would produce a different
+// tree, so trees cached by older versions are recomputed. Version 1 hashes
+// the final chunk without padding.
+const cacheVersion = 1
+
+// Cached trees are stored as cacheVersion, the file's modification
+// time in nanoseconds and then the compact tree encoding.
+func (c *treeCache) readCached(cachePath string, stat os.FileInfo) (*mtree.Tree, error) {
+	arr, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) < 9 || arr[0] != cacheVersion {
+		return nil, errors.New("cached by an older version")
+	}
+	if int64(binary.BigEndian.Uint64(arr[1:])) != stat.ModTime().UnixNano() {
+		return nil, errors.New("file modified since it was cached")
+	}
+	tree, hdr, err := mtree.Decode(arr[9:])
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Length != stat.Size() || hdr.ChunkSize != c.chunkSize || hdr.Hasher != c.hasher {
+		return nil, errors.New("cached tree does not match file")
+	}
+	return tree, nil
+}
+
+func (c *treeCache) writeCached(cachePath string, tree *mtree.Tree, stat os.FileInfo) error {
+	arr := binary.BigEndian.AppendUint64([]byte{cacheVersion}, uint64(stat.ModTime().UnixNano()))
+	arr = append(arr, tree.EncodeCompact()...)
+	tmpPath := cachePath + ".tmp"
+	if err := os.WriteFile(tmpPath, arr, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+// warm hashes every file in the background so
+// the first request for each one is fast.
+func (c *treeCache) warm(filePaths []string) {
+	go func() {
+		for _, filePath := range filePaths {
+			if _, _, err := c.get(filePath); err != nil {
+				fmt.Printf("Failed to hash %s: %s\n", filePath, err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+const testChunkSize = 64
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTreeCacheInvalidates(t *testing.T) {
+	cache, err := newTreeCache("", testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, path, merkletest.Data(5*testChunkSize))
+	tree, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := cache.get(path)
+	if err != nil || again != tree {
+		t.Errorf("second get() hashed the file again: %v", err)
+	}
+
+	// Same size, so only the modification time tells them apart
+	data := merkletest.Data(5 * testChunkSize)
+	data[0] ^= 1
+	writeTestFile(t, path, data)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(changed.RootHash(), tree.RootHash()) {
+		t.Error("get() returned the tree of the file before it changed")
+	}
+
+	os.Remove(path)
+	if _, _, err := cache.get(path); err == nil {
+		t.Error("get() of a removed file succeeded")
+	}
+}
+
+// TestTreeCachePersists replaces a persisted tree with the tree of other
+// data, so a tree read back from the cache directory can be told apart
+// from one computed by hashing the file again.
+func TestTreeCachePersists(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	path := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, path, merkletest.Data(5*testChunkSize))
+	cache, err := newTreeCache(cacheDir, testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, stat, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := merkletest.Tree(mtree.DomainSeparated, bytes.Repeat([]byte("x"), 5*testChunkSize), testChunkSize)
+	other.ChunkSize, other.Length = testChunkSize, stat.Size()
+	if err := cache.writeCached(cache.cachePath(path), other, stat); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = newTreeCache(cacheDir, testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cached.RootHash(), other.RootHash()) {
+		t.Error("get() did not load the tree from the cache directory")
+	}
+
+	// A persisted tree is ignored once the file is modified
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	cache, err = newTreeCache(cacheDir, testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rehashed, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rehashed.RootHash(), tree.RootHash()) {
+		t.Error("get() used a persisted tree of an older version of the file")
+	}
+
+	// Nor is it used by a server with another hasher
+	cache, err = newTreeCache(cacheDir, testChunkSize, mtree.Legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Hasher != mtree.Legacy || bytes.Equal(legacy.RootHash(), tree.RootHash()) {
+		t.Error("get() used a persisted tree of another hasher")
+	}
+}
+
+func TestTreeCacheFind(t *testing.T) {
+	cache, err := newTreeCache("", testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	paths := []string{}
+	for idx, size := range []int{3 * testChunkSize, 5 * testChunkSize, 7 * testChunkSize} {
+		path := filepath.Join(dir, string(rune('a'+idx)))
+		writeTestFile(t, path, merkletest.Data(size))
+		paths = append(paths, path)
+	}
+	// Files are only found once they have been hashed
+	want := merkletest.Tree(mtree.DomainSeparated, merkletest.Data(5*testChunkSize), testChunkSize)
+	if found, tree, _ := cache.find(want.RootHash(), paths); tree != nil {
+		t.Errorf("find() hashed %q", found)
+	}
+	for _, path := range paths {
+		want, _, err := cache.get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, tree, stat := cache.find(want.RootHash(), paths)
+		if found != path || tree != want || stat == nil {
+			t.Errorf("find() of the root of %s returned %q", path, found)
+		}
+	}
+	if found, tree, _ := cache.find(make([]byte, 32), paths); tree != nil {
+		t.Errorf("find() of an unknown root returned %q", found)
+	}
+}
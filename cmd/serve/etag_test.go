@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestServeFileETag(t *testing.T) {
+	cache, err := newTreeCache("", testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, path, merkletest.Data(5*testChunkSize))
+	tree, stat, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"` + hex.EncodeToString(tree.RootHash()) + `"`
+	serve := func(header, value string) *http.Response {
+		req := httptest.NewRequest("GET", "/getFile/file", nil)
+		req.Header.Set("Range", "bytes=0-9")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		serveFile(rec, req, path, tree, stat)
+		return rec.Result()
+	}
+
+	if resp := serve("", ""); resp.Header.Get("ETag") != etag {
+		t.Errorf("ETag is %s, want the root hash %s", resp.Header.Get("ETag"), etag)
+	}
+	if resp := serve("If-Match", etag); resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("If-Match with the root hash: %s", resp.Status)
+	}
+	if resp := serve("If-Match", `"00"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("If-Match with another root hash: %s", resp.Status)
+	}
+	if resp := serve("If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match with the root hash: %s", resp.Status)
+	}
+
+	// The file changed since it was hashed, so the ETag would be wrong
+	writeTestFile(t, path, merkletest.Data(6*testChunkSize))
+	if resp := serve("", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("serving a changed file: %s", resp.Status)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sync"
+)
+
+// fileSet is the set of files that can be requested from the served
+// directory. It is kept up to date by the directory watcher.
+type fileSet struct {
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+// readFileSet lists the regular files in dir.
+func readFileSet(dir string) (*fileSet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fs := &fileSet{names: map[string]struct{}{}}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			fs.names[entry.Name()] = struct{}{}
+		}
+	}
+	return fs, nil
+}
+
+func (fs *fileSet) contains(name string) bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	_, ok := fs.names[name]
+	return ok
+}
+
+func (fs *fileSet) add(name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.names[name] = struct{}{}
+}
+
+func (fs *fileSet) remove(name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.names, name)
+}
+
+// list returns the names of all files in sorted order.
+func (fs *fileSet) list() []string {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	names := make([]string, 0, len(fs.names))
+	for name := range fs.names {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+)
+
+// serveTestFile serves data with http.ServeContent behind the gzip
+// handler, like /getFile, and returns the response to req.
+// The response has the given ETag if it is not empty.
+func serveTestFile(data []byte, etag string, req *http.Request) *http.Response {
+	handler := makeGzipHandler(http.HandlerFunc(func(respW http.ResponseWriter, req *http.Request) {
+		if etag != "" {
+			respW.Header().Set("ETag", etag)
+		}
+		http.ServeContent(respW, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func TestGzipHandlerRanges(t *testing.T) {
+	data := merkletest.Data(5000)
+	tests := []struct {
+		rangeHeader string
+		want        []byte
+	}{
+		{"bytes=0-99", data[:100]},
+		{"bytes=4990-", data[4990:]},
+		{"bytes=-10", data[4990:]},
+		{"bytes=100-100", data[100:101]},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/getFile/file", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Range", test.rangeHeader)
+		resp := serveTestFile(data, "", req)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s: %s with Content-Encoding %q", test.rangeHeader, resp.Status, resp.Header.Get("Content-Encoding"))
+		}
+		if !bytes.Equal(body, test.want) {
+			t.Errorf("%s: got %d bytes that do not match the file", test.rangeHeader, len(body))
+		}
+	}
+	req := httptest.NewRequest("GET", "/getFile/file", nil)
+	req.Header.Set("Range", "bytes=6000-7000")
+	if resp := serveTestFile(data, "", req); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range past the end of the file: %s", resp.Status)
+	}
+}
+
+func TestGzipHandlerCompresses(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), 1000)
+	req := httptest.NewRequest("GET", "/getFile/file", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := serveTestFile(data, "", req)
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Content-Length") != "" {
+		t.Fatalf("Content-Encoding %q, Content-Length %q", resp.Header.Get("Content-Encoding"), resp.Header.Get("Content-Length"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(gz); err != nil || !bytes.Equal(body, data) {
+		t.Errorf("decompressed body does not match the file: %v", err)
+	}
+
+	// A HEAD response describes the uncompressed GET
+	req = httptest.NewRequest("HEAD", "/getFile/file", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp = serveTestFile(data, "", req)
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Length") != strconv.Itoa(len(data)) {
+		t.Errorf("HEAD: Content-Encoding %q, Content-Length %q", resp.Header.Get("Content-Encoding"), resp.Header.Get("Content-Length"))
+	}
+
+	// Strong ETags describe the uncompressed file
+	req = httptest.NewRequest("GET", "/getFile/file", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp = serveTestFile(data, `"root"`, req)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, data) {
+		t.Errorf("response with an ETag has Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
@@ -2,141 +2,224 @@ package main
 
 import (
 	"compress/gzip"
-	"encoding/base64"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path"
-	"slices"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/Solidsilver/merkle/verify"
+	"github.com/Solidsilver/merkle/mtree"
+	"github.com/Solidsilver/merkle/stream"
 )
 
 var port = 8039
 
 func main() {
 	pathFlag := flag.String("f", "", "Select file to serve")
+	cacheFlag := flag.String("cache", defaultCacheDir(), "Directory to persist computed trees in. Empty to only cache in memory")
+	warmFlag := flag.Bool("warm", false, "Hash every file at startup instead of on first request")
+	watchFlag := flag.Bool("watch", true, "Watch the directory and rehash files when they change")
+	pollFlag := flag.Duration("poll", 2*time.Second, "How often to rescan the directory if inotify is unavailable. 0 disables polling")
+	algName := flag.String("alg", "sha256", "Hash algorithm. One of sha256, sha512_256, sha3_256, blake2b_256 or fnv128a.")
+	domainSep := flag.Bool("ds", true, "Use domain separated (RFC 6962) leaf and interior hashing. cmd/client requires it")
 	flag.Parse()
 	if *pathFlag == "" {
 		log.Fatal("You must pass a file to serve `<cmd> -f <file>`")
 	}
-	dir, err := os.ReadDir(*pathFlag)
+	alg, err := mtree.ParseAlgorithm(*algName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fileDirName := filepath.Clean(*pathFlag)
+	files, err := readFileSet(fileDirName)
 	if err != nil {
 		log.Fatal("Failed to open dir:", err.Error())
 	}
-	fileDirName := path.Dir(*pathFlag)
-	fileList := []string{}
-	for _, entry := range dir {
-		if !entry.IsDir() {
-			fileList = append(fileList, entry.Name())
+
+	trees, err := newTreeCache(*cacheFlag, 1024, mtree.Hasher{Algorithm: alg, DomainSeparated: *domainSep})
+	if err != nil {
+		log.Fatal("Failed to create cache dir:", err.Error())
+	}
+	if *warmFlag {
+		filePaths := []string{}
+		for _, fileName := range files.list() {
+			filePaths = append(filePaths, path.Join(fileDirName, fileName))
 		}
+		trees.warm(filePaths)
+	}
+	if *watchFlag {
+		go func() {
+			err := watchDir(fileDirName, *pollFlag, func(name string) {
+				filePath := path.Join(fileDirName, name)
+				stat, err := os.Lstat(filePath)
+				if err != nil || !stat.Mode().IsRegular() {
+					fmt.Println("Removed", name)
+					files.remove(name)
+					trees.forget(filePath)
+					return
+				}
+				if !files.contains(name) {
+					fmt.Println("Added", name)
+				}
+				files.add(name)
+				trees.refresh(filePath)
+			})
+			fmt.Println("Stopped watching for changes:", err)
+		}()
 	}
 
 	router := http.NewServeMux()
 
 	router.HandleFunc("GET /getFile/{fname}", func(respW http.ResponseWriter, req *http.Request) {
-		rangeHeader := req.Header.Get("Range")
 		reqFileName := req.PathValue("fname")
-		if !slices.Contains(fileList, reqFileName) {
+		if !files.contains(reqFileName) {
 			http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
 			return
 		}
-		file, err := os.Open(path.Join(fileDirName, reqFileName))
+		filePath := path.Join(fileDirName, reqFileName)
+		tree, fs, err := trees.get(filePath)
 		if err != nil {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
-		fs, err := file.Stat()
+		serveFile(respW, req, filePath, tree, fs)
+	})
+
+	// Serves whichever file currently has the given (hex encoded)
+	// root hash, so clients can request exactly the version they verified
+	router.HandleFunc("GET /blob/{root}", func(respW http.ResponseWriter, req *http.Request) {
+		root, err := hex.DecodeString(req.PathValue("root"))
 		if err != nil {
-			http.Error(respW, err.Error(), http.StatusInternalServerError)
+			http.Error(respW, "Invalid root hash: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		fileRange, err := parseRangeHeader(rangeHeader, int(fs.Size()))
-		if err != nil {
-			http.Error(respW, err.Error(), http.StatusInternalServerError)
+		filePaths := []string{}
+		for _, fileName := range files.list() {
+			filePaths = append(filePaths, path.Join(fileDirName, fileName))
+		}
+		filePath, tree, fs := trees.find(root, filePaths)
+		if tree == nil {
+			http.Error(respW, "No file with root hash: "+req.PathValue("root"), http.StatusNotFound)
 			return
 		}
-		fileBytes := make([]byte, fileRange.end-fileRange.start)
-		_, err = file.Seek(int64(fileRange.start), 0)
-		if err != nil {
-			http.Error(respW, err.Error(), http.StatusInternalServerError)
+		// The content behind a root hash never changes
+		respW.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		serveFile(respW, req, filePath, tree, fs)
+	})
+
+	router.HandleFunc("GET /getMerkle/{id}", func(respW http.ResponseWriter, req *http.Request) {
+		reqFileName := req.PathValue("id")
+		if !files.contains(reqFileName) {
+			http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
 			return
 		}
-		_, err = file.Read(fileBytes)
+		tree, _, err := trees.get(path.Join(fileDirName, reqFileName))
 		if err != nil {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		fmt.Printf("Fetching range %d-%d\n", fileRange.start, fileRange.end)
-		fmt.Println("sending bytes")
-		respW.Write(fileBytes)
+		format := req.URL.Query().Get("format")
+		if format == "" || format == "compact" {
+			respW.Header().Set("Content-Type", "application/octet-stream")
+			respW.Write(tree.EncodeCompact())
+			return
+		}
+		if format != "full" && format != "legacy" {
+			http.Error(respW, "Unknown tree format: "+format, http.StatusBadRequest)
+			return
+		}
+		// The legacy format does not record the hasher
+		if format == "legacy" && tree.Hasher != mtree.Legacy {
+			http.Error(respW, "The legacy format requires the legacy hasher, start the server with -ds=false", http.StatusBadRequest)
+			return
+		}
+		// The cached tree is shared between requests
+		trimmed := tree.Clone()
+		trimmed.TrimLeaves()
+		respW.Header().Set("Content-Type", "application/octet-stream")
+		if format == "full" {
+			respW.Write(trimmed.Encode())
+		} else {
+			respW.Write(trimmed.ToArray())
+		}
 	})
 
-	router.HandleFunc("GET /getMerkle/{id}", func(respW http.ResponseWriter, req *http.Request) {
-		reqFileName := req.PathValue("id")
-		if !slices.Contains(fileList, reqFileName) {
+	// The combined stream encoding interleaves the tree with the file's
+	// chunks, so clients can verify the file as it is being downloaded
+	router.HandleFunc("GET /encoded/{fname}", func(respW http.ResponseWriter, req *http.Request) {
+		serveEncoded(respW, req, files, trees, fileDirName, false)
+	})
+
+	router.HandleFunc("GET /outboard/{fname}", func(respW http.ResponseWriter, req *http.Request) {
+		serveEncoded(respW, req, files, trees, fileDirName, true)
+	})
+
+	router.HandleFunc("GET /proof/{fname}/{leaves}", func(respW http.ResponseWriter, req *http.Request) {
+		reqFileName := req.PathValue("fname")
+		if !files.contains(reqFileName) {
 			http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
 			return
 		}
-		file, err := os.Open(path.Join(fileDirName, reqFileName))
+		tree, _, err := trees.get(path.Join(fileDirName, reqFileName))
 		if err != nil {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
-		tree, err := verify.HashFileHarr(path.Join(fileDirName, reqFileName), 1024)
+		leaves, err := parseLeafRange(req.PathValue("leaves"), tree.LeafCount())
+		if err != nil {
+			http.Error(respW, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proofs, err := newProofResponse(tree, leaves)
 		if err != nil {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		respW.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(respW).Encode(proofs)
+	})
 
-		tree.TrimLeaves()
-		tArr := tree.ToArray()
-		fmt.Println("--- tArr ---")
-		for i := 0; i < len(tArr); i += 64 {
-			fmt.Println(base64.StdEncoding.EncodeToString(tArr[i:i+32]) + "|" + base64.StdEncoding.EncodeToString(tArr[i+32:i+64]))
+	router.HandleFunc("GET /status", func(respW http.ResponseWriter, req *http.Request) {
+		statuses := []*fileStatus{}
+		for _, fileName := range files.list() {
+			status, err := trees.status(path.Join(fileDirName, fileName))
+			if err != nil {
+				// Removed since it was listed
+				continue
+			}
+			statuses = append(statuses, status)
 		}
-		fmt.Println("--- tArr end ---")
-		// w.Header().Add("Content-Type", "application/octet-stream")
-
-		respW.Write(tArr)
+		respW.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(respW).Encode(statuses)
 	})
 
-	router.HandleFunc("GET /fileInfo/{id}", func(respW http.ResponseWriter, req *http.Request) {
-		reqFileName := req.PathValue("id")
-		fmt.Println("Fetching file info for", reqFileName)
-		fmt.Printf("HEAD request for file %s\n", reqFileName)
-		if !slices.Contains(fileList, reqFileName) {
+	router.HandleFunc("GET /status/{fname}", func(respW http.ResponseWriter, req *http.Request) {
+		reqFileName := req.PathValue("fname")
+		if !files.contains(reqFileName) {
 			http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
 			return
 		}
-		file, err := os.Open(path.Join(fileDirName, reqFileName))
+		status, err := trees.status(path.Join(fileDirName, reqFileName))
 		if err != nil {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
-		fs, err := file.Stat()
-		if err != nil {
-			http.Error(respW, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		fmt.Fprintf(respW, `{ "size": "%d" }`, fs.Size())
+		respW.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(respW).Encode(status)
 	})
 
-	router.HandleFunc("HEAD /getFile/{fname}", func(respW http.ResponseWriter, req *http.Request) {
-		reqFileName := req.PathValue("fname")
+	router.HandleFunc("GET /fileInfo/{id}", func(respW http.ResponseWriter, req *http.Request) {
+		reqFileName := req.PathValue("id")
+		fmt.Println("Fetching file info for", reqFileName)
 		fmt.Printf("HEAD request for file %s\n", reqFileName)
-		if !slices.Contains(fileList, reqFileName) {
+		if !files.contains(reqFileName) {
 			http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
 			return
 		}
@@ -151,45 +234,99 @@ func main() {
 			http.Error(respW, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		respW.Header().Set("Content-Type", "blob")
-		respW.Header().Set("Date", time.Now().String())
-		respW.Header().Set("Content-Length", fmt.Sprintf("%d", fs.Size()))
-		respW.WriteHeader(200)
+		fmt.Fprintf(respW, `{ "size": "%d" }`, fs.Size())
 	})
+
 	fmt.Printf("Serving on port %d\n", port)
 	http.ListenAndServe(fmt.Sprintf(":%d", port), makeGzipHandler(router))
 	fmt.Println("Server closed")
 }
 
-type Range struct {
-	start int
-	end   int
+// defaultCacheDir returns the directory trees are persisted
+// in by default, or an empty string if there is none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "merkle-serve")
 }
 
-func parseRangeHeader(header string, maxLen int) (retRng Range, err error) {
-	if header == "" {
-		retRng.start = 0
-		retRng.end = maxLen
-		return retRng, nil
+// serveFile writes the file at filePath, whose tree and info were
+// returned by the tree cache, using its root hash as a strong ETag.
+// http.ServeContent implements RFC 9110 range requests, including
+// suffix and multiple ranges, and the If-Match, If-None-Match and
+// If-Range conditional headers. It also answers HEAD requests.
+func serveFile(respW http.ResponseWriter, req *http.Request, filePath string, tree *mtree.Tree, fs os.FileInfo) {
+	file, ok := openUnchanged(respW, filePath, fs)
+	if !ok {
+		return
 	}
-	header = strings.TrimPrefix(header, "bytes=")
-	rngString := strings.Split(header, "-")
-	if len(rngString) != 2 {
-		return retRng, errors.Join(errors.New("failed to parse range header"), err)
+	defer file.Close()
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		fmt.Printf("Fetching %s of %s\n", rangeHeader, filepath.Base(filePath))
 	}
-	retRng.start, err = strconv.Atoi(rngString[0])
+	respW.Header().Set("Content-Type", "application/octet-stream")
+	respW.Header().Set("ETag", `"`+hex.EncodeToString(tree.RootHash())+`"`)
+	http.ServeContent(respW, req, filepath.Base(filePath), fs.ModTime(), file)
+}
+
+// openUnchanged opens the file at filePath, checking that it has not
+// changed since it was hashed with the given info, as the tree would
+// not match the bytes we send. It writes an error response and returns
+// false if the file cannot be served.
+func openUnchanged(respW http.ResponseWriter, filePath string, fs os.FileInfo) (*os.File, bool) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return retRng, errors.Join(errors.New("failed to parse range header"), err)
+		http.Error(respW, err.Error(), http.StatusInternalServerError)
+		return nil, false
 	}
-	retRng.end, err = strconv.Atoi(rngString[1])
+	current, err := file.Stat()
 	if err != nil {
-		return retRng, errors.Join(errors.New("failed to parse range header"), err)
+		file.Close()
+		http.Error(respW, err.Error(), http.StatusInternalServerError)
+		return nil, false
 	}
+	if current.Size() != fs.Size() || !current.ModTime().Equal(fs.ModTime()) {
+		file.Close()
+		respW.Header().Set("Retry-After", "1")
+		http.Error(respW, "File changed while it was being served", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return file, true
+}
 
-	if retRng.end > maxLen {
-		return retRng, fmt.Errorf("range header out of bounds (requested %d in file of size %d)", retRng.end, maxLen)
+// serveEncoded writes the stream encoding of the requested file, or
+// only its outboard encoding if outboard is set.
+func serveEncoded(respW http.ResponseWriter, req *http.Request, files *fileSet, trees *treeCache, fileDirName string, outboard bool) {
+	reqFileName := req.PathValue("fname")
+	if !files.contains(reqFileName) {
+		http.Error(respW, "File does not exist: "+reqFileName, http.StatusNotFound)
+		return
+	}
+	filePath := path.Join(fileDirName, reqFileName)
+	tree, fs, err := trees.get(filePath)
+	if err != nil {
+		http.Error(respW, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respW.Header().Set("Content-Type", "application/octet-stream")
+	if outboard {
+		respW.Header().Set("Content-Length", fmt.Sprint(stream.OutboardSize(tree.LeafCount(), tree.Hasher.Size())))
+		stream.EncodeOutboard(respW, tree)
+		return
+	}
+	file, ok := openUnchanged(respW, filePath, fs)
+	if !ok {
+		return
+	}
+	defer file.Close()
+	respW.Header().Set("Content-Length", fmt.Sprint(stream.EncodedSize(tree.LeafCount(), tree.Hasher.Size(), fs.Size())))
+	if err := stream.Encode(respW, tree, file); err != nil {
+		// Too late to send an error status, the client
+		// sees a short body that fails verification
+		fmt.Printf("Failed to encode %s: %s\n", reqFileName, err.Error())
 	}
-	return retRng, nil
 }
 
 // func hashBytes(data []byte) (*mtree.Tree, error) {
@@ -226,25 +363,63 @@ func parseRangeHeader(header string, maxLen int) (retRng Range, err error) {
 // 	return bt, nil
 // }
 
+// gzipResponseWriter compresses the response unless the handler set an
+// ETag. Strong validators must differ between content codings (RFC 9110
+// section 8.8.3), and ours identify the uncompressed file, which is also
+// what byte ranges refer to, so those responses are sent as is.
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	gz       *gzip.Writer
+	identity bool
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+// start decides whether to compress on the first call to Write or
+// WriteHeader, once the handler has set its headers.
+func (w *gzipResponseWriter) start() {
+	if w.gz != nil || w.identity {
+		return
+	}
+	if w.Header().Get("ETag") != "" {
+		w.identity = true
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	// The handler's Content-Length is the length of the uncompressed body
+	w.Header().Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	w.start()
+	if w.identity {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
 }
 
 func makeGzipHandler(fn http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Add("Vary", "Accept-Encoding")
+		// Byte ranges refer to the uncompressed file, and a HEAD
+		// response must describe the body a GET would have returned
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") ||
+			r.Header.Get("Range") != "" || r.Method == http.MethodHead {
 			fn.ServeHTTP(w, r)
 			return
 		}
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		gzr := gzipResponseWriter{Writer: gz, ResponseWriter: w}
+		gzr := &gzipResponseWriter{ResponseWriter: w}
+		defer gzr.close()
 		fn.ServeHTTP(gzr, r)
 	})
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// maxProofs limits how many leaves a single /proof request may cover
+const maxProofs = 1024
+
+// proofResponse is the JSON body returned by /proof.
+// Hashes are base64 encoded. A client holding a trusted root only
+// needs the proofs and the chunk size to verify arbitrary reads.
+type proofResponse struct {
+	Root            []byte         `json:"root"`
+	Algorithm       string         `json:"algorithm"`
+	DomainSeparated bool           `json:"domainSeparated"`
+	ChunkSize       int            `json:"chunkSize"`
+	Length          int64          `json:"length"`
+	Leaves          int            `json:"leaves"`
+	Proofs          []*mtree.Proof `json:"proofs"`
+}
+
+func newProofResponse(tree *mtree.Tree, leaves mtree.LeafRange) (*proofResponse, error) {
+	resp := &proofResponse{
+		Root:            tree.RootHash(),
+		Algorithm:       tree.Hasher.Algorithm.String(),
+		DomainSeparated: tree.Hasher.DomainSeparated,
+		ChunkSize:       tree.ChunkSize,
+		Length:          tree.Length,
+		Leaves:          tree.LeafCount(),
+	}
+	for idx := leaves.Start; idx < leaves.End; idx++ {
+		proof, err := tree.Proof(idx)
+		if err != nil {
+			return nil, err
+		}
+		resp.Proofs = append(resp.Proofs, proof)
+	}
+	return resp, nil
+}
+
+// parseLeafRange parses a single leaf index ("12") or an
+// inclusive range of leaf indexes ("12-20").
+func parseLeafRange(str string, leafCount int) (mtree.LeafRange, error) {
+	var lr mtree.LeafRange
+	startStr, endStr, isRange := strings.Cut(str, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return lr, errors.Join(errors.New("failed to parse leaf index"), err)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(endStr)
+		if err != nil {
+			return lr, errors.Join(errors.New("failed to parse leaf index"), err)
+		}
+	}
+	if start < 0 || end < start || end >= leafCount {
+		return lr, fmt.Errorf("leaves %s out of range for tree with %d leaves", str, leafCount)
+	}
+	if end-start+1 > maxProofs {
+		return lr, fmt.Errorf("at most %d proofs can be requested at once", maxProofs)
+	}
+	lr.Start, lr.End = start, end+1
+	return lr, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestParseLeafRange(t *testing.T) {
+	tests := []struct {
+		str  string
+		want mtree.LeafRange
+	}{
+		{"0", mtree.LeafRange{Start: 0, End: 1}},
+		{"9", mtree.LeafRange{Start: 9, End: 10}},
+		{"2-5", mtree.LeafRange{Start: 2, End: 6}},
+		{"3-3", mtree.LeafRange{Start: 3, End: 4}},
+		{"0-9", mtree.LeafRange{Start: 0, End: 10}},
+	}
+	for _, test := range tests {
+		got, err := parseLeafRange(test.str, 10)
+		if err != nil || got != test.want {
+			t.Errorf("parseLeafRange(%q) = %v, %v, want %v", test.str, got, err, test.want)
+		}
+	}
+	for _, str := range []string{"", "-", "a", "1-b", "-1", "10", "5-10", "5-4", "1-2-3", " 1"} {
+		if got, err := parseLeafRange(str, 10); err == nil {
+			t.Errorf("parseLeafRange(%q) = %v, want an error", str, got)
+		}
+	}
+	if _, err := parseLeafRange(fmt.Sprintf("0-%d", maxProofs), maxProofs+1); err == nil {
+		t.Errorf("parseLeafRange accepted %d proofs", maxProofs+1)
+	}
+	if _, err := parseLeafRange(fmt.Sprintf("1-%d", maxProofs), maxProofs+1); err != nil {
+		t.Errorf("parseLeafRange rejected %d proofs: %v", maxProofs, err)
+	}
+}
+
+// TestProofResponse checks that proofs survive the JSON encoding
+// and verify the chunks they were requested for.
+func TestProofResponse(t *testing.T) {
+	h := mtree.DomainSeparated
+	tree := mtree.NewEmpty()
+	tree.Hasher = h
+	chunks := make([][]byte, 11)
+	for idx := range chunks {
+		chunks[idx] = []byte(fmt.Sprintf("chunk %d", idx))
+		tree.AddData(chunks[idx])
+	}
+	tree.ChunkSize, tree.Length = 8, 85
+	resp, err := newProofResponse(tree, mtree.LeafRange{Start: 4, End: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded proofResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Leaves != 11 || decoded.ChunkSize != 8 || decoded.Length != 85 || decoded.Algorithm != "sha256" || !decoded.DomainSeparated {
+		t.Errorf("proof response = %+v", decoded)
+	}
+	if len(decoded.Proofs) != 5 {
+		t.Fatalf("got %d proofs, want 5", len(decoded.Proofs))
+	}
+	for idx, proof := range decoded.Proofs {
+		if !h.VerifyProof(decoded.Root, chunks[4+idx], proof) {
+			t.Errorf("proof of leaf %d does not verify", 4+idx)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchDir calls onChange with the name of every file in dir that is
+// created, modified or removed. It uses inotify where available and
+// otherwise rescans dir every poll interval. It only returns if
+// watching fails.
+func watchDir(dir string, poll time.Duration, onChange func(name string)) error {
+	err := watchNotify(dir, onChange)
+	if err != nil && poll > 0 {
+		fmt.Printf("Falling back to polling %s every %s: %s\n", dir, poll, err.Error())
+		return pollDir(dir, poll, onChange)
+	}
+	return err
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// pollDir rescans dir every interval and reports
+// files whose size or modification time changed.
+func pollDir(dir string, interval time.Duration, onChange func(name string)) error {
+	seen, err := scanDir(dir)
+	if err != nil {
+		return err
+	}
+	for range time.Tick(interval) {
+		current, err := scanDir(dir)
+		if err != nil {
+			return err
+		}
+		reportChanges(seen, current, onChange)
+		seen = current
+	}
+	return nil
+}
+
+// reportChanges calls onChange for every file whose size or
+// modification time differs between seen and current, and for
+// every file that is only in one of them.
+func reportChanges(seen, current map[string]fileState, onChange func(name string)) {
+	for name, state := range current {
+		if prev, ok := seen[name]; !ok || prev.size != state.size || !prev.modTime.Equal(state.modTime) {
+			onChange(name)
+		}
+	}
+	for name := range seen {
+		if _, ok := current[name]; !ok {
+			onChange(name)
+		}
+	}
+}
+
+func scanDir(dir string) (map[string]fileState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	states := map[string]fileState{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		states[entry.Name()] = fileState{size: info.Size(), modTime: info.ModTime()}
+	}
+	return states, nil
+}
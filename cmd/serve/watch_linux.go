@@ -0,0 +1,97 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchNotify reports changes to files in dir using inotify.
+func watchNotify(dir string, onChange func(name string)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	// New and modified files are only picked up once they have been
+	// closed after writing, not while they are still being copied in
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_ATTRIB |
+		unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO)
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		return err
+	}
+	w, err := newNotifyWatcher(dir, onChange)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := buf[nameStart : nameStart+int(event.Len)]
+			offset = nameStart + int(event.Len)
+			// Names are padded with NUL bytes
+			if end := bytes.IndexByte(name, 0); end >= 0 {
+				name = name[:end]
+			}
+			if err := w.handle(event.Mask, string(name)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// notifyWatcher keeps the state of every file it has reported,
+// so that changes whose events were dropped can still be found.
+type notifyWatcher struct {
+	dir      string
+	seen     map[string]fileState
+	onChange func(name string)
+}
+
+func newNotifyWatcher(dir string, onChange func(name string)) (*notifyWatcher, error) {
+	seen, err := scanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyWatcher{dir: dir, seen: seen, onChange: onChange}, nil
+}
+
+// handle reports the file an inotify event is about. When the
+// kernel dropped events it rescans the directory instead.
+func (w *notifyWatcher) handle(mask uint32, name string) error {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		current, err := scanDir(w.dir)
+		if err != nil {
+			return err
+		}
+		reportChanges(w.seen, current, w.onChange)
+		w.seen = current
+		return nil
+	}
+	if mask&unix.IN_ISDIR != 0 || name == "" {
+		return nil
+	}
+	info, err := os.Lstat(filepath.Join(w.dir, name))
+	if err == nil && info.Mode().IsRegular() {
+		w.seen[name] = fileState{size: info.Size(), modTime: info.ModTime()}
+	} else {
+		delete(w.seen, name)
+	}
+	w.onChange(name)
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNotifyWatcherOverflow(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"kept", "modified", "removed"} {
+		writeTestFile(t, filepath.Join(dir, name), []byte(name))
+	}
+	var changes []string
+	w, err := newNotifyWatcher(dir, func(name string) { changes = append(changes, name) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "added"), []byte("added"))
+	if err := w.handle(unix.IN_CLOSE_WRITE, "added"); err != nil {
+		t.Fatal(err)
+	}
+	// The events for these are dropped
+	writeTestFile(t, filepath.Join(dir, "modified"), []byte("modified again"))
+	os.Remove(filepath.Join(dir, "removed"))
+	os.Remove(filepath.Join(dir, "added"))
+	writeTestFile(t, filepath.Join(dir, "new"), []byte("new"))
+	if err := w.handle(unix.IN_Q_OVERFLOW, ""); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(changes[1:])
+	if want := []string{"added", "added", "modified", "new", "removed"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("reported %v, want %v", changes, want)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// watchNotify is only implemented on Linux,
+// other platforms poll the directory instead.
+func watchNotify(dir string, onChange func(name string)) error {
+	return errors.New("inotify is not supported on this platform")
+}
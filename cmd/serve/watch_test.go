@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestReadFileSet(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b", "a"} {
+		writeTestFile(t, filepath.Join(dir, name), []byte(name))
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := readFileSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := files.list(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list() = %v, want %v", got, want)
+	}
+	files.add("c")
+	files.remove("a")
+	if !files.contains("c") || files.contains("a") {
+		t.Errorf("list() after add and remove = %v", files.list())
+	}
+}
+
+// expectChange waits for the watcher to report name.
+func expectChange(t *testing.T, changes chan string, name string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-changes:
+			if got == name {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no change reported for %s", name)
+		}
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	watchers := map[string]func(dir string, onChange func(string)) error{
+		"watchDir": func(dir string, onChange func(string)) error { return watchDir(dir, 10*time.Millisecond, onChange) },
+		"pollDir":  func(dir string, onChange func(string)) error { return pollDir(dir, 10*time.Millisecond, onChange) },
+	}
+	for name, watch := range watchers {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file")
+			changes := make(chan string, 100)
+			go watch(dir, func(name string) { changes <- name })
+			// Give the watcher time to start
+			time.Sleep(50 * time.Millisecond)
+
+			writeTestFile(t, path, []byte("created"))
+			expectChange(t, changes, "file")
+			writeTestFile(t, path, []byte("modified"))
+			expectChange(t, changes, "file")
+			os.Remove(path)
+			expectChange(t, changes, "file")
+		})
+	}
+}
+
+func TestTreeCacheStatus(t *testing.T) {
+	cache, err := newTreeCache(t.TempDir(), testChunkSize, mtree.DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	writeTestFile(t, path, []byte("some data"))
+	status, err := cache.status(path)
+	if err != nil || status.State != statePending {
+		t.Errorf("status() before hashing = %+v, %v", status, err)
+	}
+	tree, _, err := cache.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = cache.status(path)
+	if err != nil || status.State != stateReady || !bytes.Equal(status.Root, tree.RootHash()) {
+		t.Errorf("status() after hashing = %+v, %v", status, err)
+	}
+	cache.forget(path)
+	if _, err := os.Stat(cache.cachePath(path)); err == nil {
+		t.Error("forget() left the persisted tree behind")
+	}
+	if status, _ := cache.status(path); status.State != statePending {
+		t.Errorf("status() after forget() = %+v", status)
+	}
+}
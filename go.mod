@@ -2,12 +2,15 @@ module github.com/Solidsilver/merkle
 
 go 1.22.0
 
-require github.com/schollz/progressbar/v3 v3.14.4
+require (
+	github.com/schollz/progressbar/v3 v3.14.4
+	golang.org/x/crypto v0.25.0
+	golang.org/x/sys v0.22.0
+)
 
 require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/term v0.22.0 // indirect
 )
@@ -0,0 +1,134 @@
+package hash
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// gear maps each byte to a random value for the Gear rolling hash.
+// Chunk boundaries, and so the roots of content-defined trees,
+// depend on this table, so it must never change.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed
+	seed := uint64(0x6d65726b6c65)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits a stream into content-defined chunks using FastCDC.
+// Boundaries are chosen where a Gear rolling hash over the last 64
+// bytes matches a mask, so inserting or removing bytes only moves the
+// boundaries of the chunks around the change. Chunks are between
+// minSize and maxSize bytes, except for the final chunk which may be
+// shorter, and average about avgSize bytes.
+type Chunker struct {
+	r       io.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	// Normalized chunking: a harder mask before avgSize and an easier
+	// one after it, which keeps chunk sizes close to the average
+	maskS uint64
+	maskL uint64
+
+	buf []byte
+	// Unread bytes are buf[start:end]
+	start int
+	end   int
+	eof   bool
+}
+
+// NewChunker returns a Chunker splitting r into chunks of
+// minSize to maxSize bytes, averaging about avgSize bytes.
+func NewChunker(r io.Reader, minSize, avgSize, maxSize int) (*Chunker, error) {
+	if minSize < 1 || minSize > avgSize || avgSize > maxSize {
+		return nil, errors.New("chunk sizes must satisfy 0 < min <= avg <= max")
+	}
+	avgBits := bits.Len(uint(avgSize)) - 1
+	return &Chunker{
+		r:       r,
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   topBits(avgBits + 2),
+		maskL:   topBits(max(avgBits-2, 1)),
+		buf:     make([]byte, 2*maxSize),
+	}, nil
+}
+
+// topBits returns a mask of the n most significant bits,
+// which are the ones mixing in the most input bytes.
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - min(n, 64))
+}
+
+// Next returns the next chunk, or io.EOF once the input is exhausted.
+// The chunk is only valid until the next call to Next.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	data := c.buf[c.start:c.end]
+	n := c.cut(data)
+	c.start += n
+	return data[:n], nil
+}
+
+// fill reads until at least maxSize bytes are buffered or the input ends.
+func (c *Chunker) fill() error {
+	if c.end-c.start >= c.maxSize || c.eof {
+		return nil
+	}
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	for c.end < c.maxSize {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	n = min(n, c.maxSize)
+	normal := min(c.avgSize, n)
+	var h uint64
+	// The first minSize bytes can never end a chunk, so they are skipped
+	i := c.minSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package hash
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+)
+
+const (
+	testMinSize = 64
+	testAvgSize = 256
+	testMaxSize = 1024
+)
+
+func chunkAll(t *testing.T, r io.Reader) [][]byte {
+	t.Helper()
+	chunker, err := NewChunker(r, testMinSize, testAvgSize, testMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+}
+
+func TestChunkerCoversInput(t *testing.T) {
+	for _, size := range []int{0, 1, testMinSize, testMaxSize, testMaxSize + 1, 100_000} {
+		data := merkletest.Data(size)
+		// OneByteReader checks that boundaries do not depend on read sizes
+		for _, r := range []io.Reader{bytes.NewReader(data), iotest.OneByteReader(bytes.NewReader(data))} {
+			chunks := chunkAll(t, r)
+			if joined := bytes.Join(chunks, nil); !bytes.Equal(joined, data) {
+				t.Fatalf("%d bytes: chunks do not add up to the input", size)
+			}
+			for idx, chunk := range chunks {
+				last := idx == len(chunks)-1
+				if len(chunk) > testMaxSize || len(chunk) == 0 || (!last && len(chunk) < testMinSize) {
+					t.Errorf("%d bytes: chunk %d of %d has %d bytes", size, idx, len(chunks), len(chunk))
+				}
+			}
+		}
+	}
+}
+
+func TestChunkerAverageSize(t *testing.T) {
+	data := merkletest.Data(1 << 20)
+	chunks := chunkAll(t, bytes.NewReader(data))
+	avg := len(data) / len(chunks)
+	if avg < testAvgSize/2 || avg > testAvgSize*2 {
+		t.Errorf("average chunk size is %d, want about %d", avg, testAvgSize)
+	}
+}
+
+// TestChunkerInsertion checks that inserting bytes only
+// changes the chunks around the insertion.
+func TestChunkerInsertion(t *testing.T) {
+	data := merkletest.Data(200_000)
+	edited := bytes.Clone(data[:100_000])
+	edited = append(edited, []byte("inserted bytes")...)
+	edited = append(edited, data[100_000:]...)
+
+	before := map[string]bool{}
+	for _, chunk := range chunkAll(t, bytes.NewReader(data)) {
+		before[string(chunk)] = true
+	}
+	after := chunkAll(t, bytes.NewReader(edited))
+	changed := 0
+	for _, chunk := range after {
+		if !before[string(chunk)] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 3 {
+		t.Errorf("%d of %d chunks changed after inserting bytes", changed, len(after))
+	}
+}
+
+func TestNewChunkerRejectsInvalidSizes(t *testing.T) {
+	for _, sizes := range [][3]int{{0, 1, 2}, {2, 1, 4}, {1, 4, 2}} {
+		if _, err := NewChunker(bytes.NewReader(nil), sizes[0], sizes[1], sizes[2]); err == nil {
+			t.Errorf("NewChunker accepted sizes %v", sizes)
+		}
+	}
+}
+
+func TestChunkerReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(merkletest.Data(5000)), iotest.ErrReader(errRead))
+	chunker, err := NewChunker(r, testMinSize, testAvgSize, testMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, err := chunker.Next()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, errRead) {
+			t.Errorf("Next() returned %v, want the read error", err)
+		}
+		return
+	}
+}
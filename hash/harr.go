@@ -13,27 +13,46 @@ import (
 // catHash concatenates the given hashes
 // (padding if one is smaller) and returns
 // a hash of the concatenated values.
-func catHash(h1, h2 []byte) []byte {
-	catHash := make([]byte, 64)
-	copy(catHash[:32], h1)
-	copy(catHash[32:], h2)
-	return Do(catHash)
+func catHash(hasher mtree.Hasher, h1, h2 []byte) []byte {
+	return hasher.Interior(cat(hasher, h1, h2))
+}
+
+// cat concatenates the given hashes into
+// the Val of an interior node, padding
+// either one if it is smaller than the
+// hasher's digest size.
+func cat(hasher mtree.Hasher, h1, h2 []byte) []byte {
+	size := hasher.Size()
+	ch := make([]byte, 2*size)
+	copy(ch[:size], h1)
+	copy(ch[size:], h2)
+	return ch
 }
 
 type HashArray struct {
 	nodeList   []mtree.Node
 	curNodeIdx int
+	hasher     mtree.Hasher
 }
 
 func NewHashArray(chunks int) *HashArray {
+	return NewHashArrayWith(chunks, mtree.Legacy)
+}
+
+// NewHashArrayWith creates a HashArray that
+// hashes leaves and interior nodes with hasher.
+func NewHashArrayWith(chunks int, hasher mtree.Hasher) *HashArray {
 	return &HashArray{
 		nodeList: make([]mtree.Node, chunks),
+		hasher:   hasher,
 	}
 }
 
 type HashJob struct {
 	data []byte
 	idx  int
+	// data is returned to pool once hashed, if set
+	pool *BufferPool
 }
 
 // HashWorker pulls an available job off
@@ -41,15 +60,25 @@ type HashJob struct {
 // and inserts it at the proper location in the HashArray
 func HashWorker(jobs chan HashJob, harr *HashArray, wg *sync.WaitGroup) {
 	for hj := range jobs {
-		harr.nodeList[hj.idx].Val = Do(hj.data)
+		harr.nodeList[hj.idx].Val = harr.hasher.Leaf(hj.data)
+		if hj.pool != nil {
+			hj.pool.Put(hj.data)
+		}
 	}
 	wg.Done()
 }
 
 func (harr *HashArray) QueueHashInsert(val []byte, jobs chan HashJob) {
+	harr.QueuePooledHashInsert(val, nil, jobs)
+}
+
+// QueuePooledHashInsert queues val like QueueHashInsert,
+// and the worker returns val to pool once it is hashed.
+func (harr *HashArray) QueuePooledHashInsert(val []byte, pool *BufferPool, jobs chan HashJob) {
 	jobs <- HashJob{
 		data: val,
 		idx:  harr.curNodeIdx,
+		pool: pool,
 	}
 	harr.curNodeIdx++
 }
@@ -59,7 +88,11 @@ func (harr *HashArray) QueueHashInsert(val []byte, jobs chan HashJob) {
 // and building up from there
 func (harr *HashArray) BuildTree() *mtree.Tree {
 	bt := mtree.NewEmpty()
+	bt.Hasher = harr.hasher
 	curLen := len(harr.nodeList)
+	if curLen == 0 {
+		return bt
+	}
 	if curLen == 1 {
 		bt.Root = &harr.nodeList[0]
 		return bt
@@ -67,11 +100,9 @@ func (harr *HashArray) BuildTree() *mtree.Tree {
 	newLen := int(math.Ceil(float64(curLen) / 2))
 	for newLen > 1 {
 		for i := 0; i < curLen-1; i += 2 {
-			ch := make([]byte, 64)
 			nL := harr.nodeList[i]
 			nR := harr.nodeList[i+1]
-			copy(ch[:32], nL.ComputeHash())
-			copy(ch[32:], nR.ComputeHash())
+			ch := cat(harr.hasher, nL.ComputeHashWith(harr.hasher), nR.ComputeHashWith(harr.hasher))
 
 			parent := mtree.NewNode(ch, &nL, &nR)
 
@@ -98,9 +129,7 @@ func (harr *HashArray) BuildTree() *mtree.Tree {
 	nL := harr.nodeList[0]
 	nR := harr.nodeList[1]
 
-	ch := make([]byte, 64)
-	copy(ch[:32], nL.ComputeHash())
-	copy(ch[32:], nR.ComputeHash())
+	ch := cat(harr.hasher, nL.ComputeHashWith(harr.hasher), nR.ComputeHashWith(harr.hasher))
 	btr := mtree.NewNode(ch, &nL, &nR)
 	bt.Root = &btr
 	return bt
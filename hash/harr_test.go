@@ -0,0 +1,54 @@
+package hash
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// buildArray hashes n distinct chunks into a HashArray and builds its tree.
+func buildArray(h mtree.Hasher, n int) ([][]byte, *mtree.Tree) {
+	chunks := make([][]byte, n)
+	harr := NewHashArrayWith(n, h)
+	for idx := range chunks {
+		chunks[idx] = []byte(fmt.Sprintf("chunk %d", idx))
+		harr.nodeList[idx].Val = h.Leaf(chunks[idx])
+	}
+	return chunks, harr.BuildTree()
+}
+
+func TestBuildTreeProof(t *testing.T) {
+	// FNV128a has a smaller digest than the nodes are padded to
+	for _, h := range []mtree.Hasher{mtree.Legacy, mtree.DomainSeparated, {Algorithm: mtree.FNV128a}} {
+		for n := 1; n <= 33; n++ {
+			chunks, tree := buildArray(h, n)
+			added := mtree.NewEmpty()
+			added.Hasher = h
+			for _, chunk := range chunks {
+				added.AddData(chunk)
+			}
+			root := tree.RootHash()
+			if !bytes.Equal(root, added.RootHash()) {
+				t.Errorf("%v, %d leaves: BuildTree root differs from AddData", h, n)
+			}
+			for idx, chunk := range chunks {
+				proof, err := tree.Proof(idx)
+				if err != nil {
+					t.Fatalf("%v, %d leaves: Proof(%d): %v", h, n, idx, err)
+				}
+				if !h.VerifyProof(root, chunk, proof) {
+					t.Errorf("%v, %d leaves: proof of leaf %d does not verify", h, n, idx)
+				}
+				if n > 1 && h.VerifyProof(root, chunks[(idx+1)%n], proof) {
+					t.Errorf("%v, %d leaves: proof of leaf %d verifies the data of another leaf", h, n, idx)
+				}
+				proof.Index = (idx + 1) % n
+				if n > 1 && h.VerifyProof(root, chunk, proof) {
+					t.Errorf("%v, %d leaves: proof of leaf %d verifies as leaf %d", h, n, idx, proof.Index)
+				}
+			}
+		}
+	}
+}
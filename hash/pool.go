@@ -0,0 +1,35 @@
+package hash
+
+import "sync"
+
+// BufferPool reuses chunk buffers of a fixed size, so hashing
+// a large file does not allocate a new buffer for every chunk.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool creates a BufferPool of buffers holding size bytes.
+func NewBufferPool(size int) *BufferPool {
+	p := &BufferPool{size: size}
+	p.pool.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// Get returns a buffer of the pool's size. Its contents are undefined.
+func (p *BufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer obtained from Get, or a slice of
+// one, to the pool. The buffer must not be used afterwards.
+func (p *BufferPool) Put(buf []byte) {
+	if cap(buf) < p.size {
+		return
+	}
+	buf = buf[:p.size]
+	p.pool.Put(&buf)
+}
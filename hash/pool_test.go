@@ -0,0 +1,23 @@
+package hash
+
+import "testing"
+
+func TestBufferPool(t *testing.T) {
+	pool := NewBufferPool(64)
+	buf := pool.Get()
+	if len(buf) != 64 {
+		t.Fatalf("Get() returned %d bytes, want 64", len(buf))
+	}
+	// A slice of a buffer is returned whole
+	pool.Put(buf[:10])
+	if buf := pool.Get(); len(buf) != 64 {
+		t.Errorf("Get() after Put of a slice returned %d bytes", len(buf))
+	}
+	// Buffers too small for the pool are dropped
+	pool.Put(make([]byte, 10))
+	for range 10 {
+		if buf := pool.Get(); len(buf) != 64 {
+			t.Fatalf("Get() returned a %d byte buffer put in from elsewhere", len(buf))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package hash
+
+import (
+	"fmt"
+	stdhash "hash"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Stream computes the Merkle root of everything written to it,
+// splitting the input into chunks of splitSize bytes. Unlike
+// HashArray it never holds the tree in memory, so it can hash
+// inputs of any size using O(log n) memory.
+//
+// Stream implements the standard library's hash.Hash, so it
+// can be used with io.Copy, io.MultiWriter and io.TeeReader
+// alongside other hashes.
+type Stream struct {
+	splitSize int
+	// Buffered bytes of the current, incomplete chunk
+	chunk    []byte
+	frontier *mtree.Frontier
+}
+
+var _ stdhash.Hash = (*Stream)(nil)
+
+// New returns a hash.Hash computing the Merkle root of its
+// input split into splitSize chunks, using the [mtree.Legacy] hasher.
+// It panics if splitSize is less than 1.
+func New(splitSize int) stdhash.Hash {
+	return NewStream(splitSize, mtree.Legacy)
+}
+
+// NewStream creates a Stream that splits its
+// input into splitSize chunks and hashes them with hasher.
+// It panics if splitSize is less than 1.
+func NewStream(splitSize int, hasher mtree.Hasher) *Stream {
+	if splitSize < 1 {
+		panic(fmt.Sprintf("hash: invalid split size %d", splitSize))
+	}
+	return &Stream{
+		splitSize: splitSize,
+		chunk:     make([]byte, 0, splitSize),
+		frontier:  mtree.NewFrontier(hasher),
+	}
+}
+
+// Write adds more data to the stream. It never returns an error.
+func (s *Stream) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(s.chunk) > 0 {
+		fill := min(s.splitSize-len(s.chunk), len(p))
+		s.chunk = append(s.chunk, p[:fill]...)
+		p = p[fill:]
+		if len(s.chunk) < s.splitSize {
+			return n, nil
+		}
+		s.frontier.AddData(s.chunk)
+		s.chunk = s.chunk[:0]
+	}
+	// Hash full chunks straight from p to avoid copying
+	for len(p) >= s.splitSize {
+		s.frontier.AddData(p[:s.splitSize])
+		p = p[s.splitSize:]
+	}
+	s.chunk = append(s.chunk, p...)
+	return n, nil
+}
+
+// Sum appends the current Merkle root to b and returns the
+// resulting slice. It does not change the state of the stream.
+// A trailing partial chunk is hashed as is, and the root of
+// an empty stream is the hash of no data.
+func (s *Stream) Sum(b []byte) []byte {
+	f := s.frontier
+	if len(s.chunk) > 0 {
+		f = f.Clone()
+		f.AddData(s.chunk)
+	}
+	return append(b, f.RootHash()...)
+}
+
+// Leaves returns the number of leaves written so far,
+// including a trailing partial chunk.
+func (s *Stream) Leaves() int {
+	if len(s.chunk) > 0 {
+		return s.frontier.Leaves() + 1
+	}
+	return s.frontier.Leaves()
+}
+
+// Reset resets the stream to its initial state.
+func (s *Stream) Reset() {
+	s.chunk = s.chunk[:0]
+	s.frontier = mtree.NewFrontier(s.frontier.Hasher)
+}
+
+// Size returns the number of bytes Sum will append,
+// which is the digest size of the stream's hasher.
+func (s *Stream) Size() int {
+	return s.frontier.Hasher.Size()
+}
+
+// BlockSize returns the split size of the stream.
+// Writes that are a multiple of it avoid buffering.
+func (s *Stream) BlockSize() int {
+	return s.splitSize
+}
@@ -0,0 +1,104 @@
+package hash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+const testSplitSize = 64
+
+// arrayRoot hashes data split into testSplitSize chunks with HashArray.
+func arrayRoot(h mtree.Hasher, data []byte) []byte {
+	chunks := (len(data) + testSplitSize - 1) / testSplitSize
+	harr := NewHashArrayWith(chunks, h)
+	for idx := range chunks {
+		harr.nodeList[idx].Val = h.Leaf(data[idx*testSplitSize : min((idx+1)*testSplitSize, len(data))])
+	}
+	return harr.BuildTree().RootHash()
+}
+
+func TestStreamMatchesTree(t *testing.T) {
+	for _, h := range []mtree.Hasher{mtree.Legacy, mtree.DomainSeparated} {
+		for _, size := range merkletest.Sizes(testSplitSize) {
+			data := merkletest.Data(size)
+			want := merkletest.Tree(h, data, testSplitSize).RootHash()
+			if got := arrayRoot(h, data); !bytes.Equal(got, want) {
+				t.Errorf("%v, %d bytes: HashArray root differs from Tree", h, size)
+			}
+			// Writes of every size, so chunks are split across writes
+			for _, writeSize := range []int{1, 7, testSplitSize, 1000} {
+				stream := NewStream(testSplitSize, h)
+				for start := 0; start < size; start += writeSize {
+					stream.Write(data[start:min(start+writeSize, size)])
+				}
+				if got := stream.Sum(nil); !bytes.Equal(got, want) {
+					t.Errorf("%v, %d bytes in writes of %d: Stream root differs from Tree", h, size, writeSize)
+				}
+				if got, want := stream.Leaves(), (size+testSplitSize-1)/testSplitSize; got != want {
+					t.Errorf("%v, %d bytes: Leaves() = %d, want %d", h, size, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamSumDoesNotChangeState(t *testing.T) {
+	data := merkletest.Data(3*testSplitSize + 10)
+	stream := NewStream(testSplitSize, mtree.DomainSeparated)
+	stream.Write(data[:100])
+	stream.Sum(nil)
+	stream.Write(data[100:])
+	want := merkletest.Tree(mtree.DomainSeparated, data, testSplitSize).RootHash()
+	if got := stream.Sum(nil); !bytes.Equal(got, want) {
+		t.Error("calling Sum changed the root of later writes")
+	}
+}
+
+func TestStreamHash(t *testing.T) {
+	data := merkletest.Data(5*testSplitSize + 3)
+	stream := NewStream(testSplitSize, mtree.DomainSeparated)
+	digest := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(stream, digest), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(data); !bytes.Equal(digest.Sum(nil), want[:]) {
+		t.Error("io.MultiWriter did not also write to the other hash")
+	}
+	root := stream.Sum(nil)
+	if len(root) != stream.Size() || stream.BlockSize() != testSplitSize {
+		t.Errorf("root has %d bytes, Size() = %d, BlockSize() = %d", len(root), stream.Size(), stream.BlockSize())
+	}
+	stream.Reset()
+	if got := stream.Sum(nil); !bytes.Equal(got, mtree.DomainSeparated.Empty()) {
+		t.Error("Reset did not discard the written data")
+	}
+	stream.Write(data)
+	if got := stream.Sum(nil); !bytes.Equal(got, root) {
+		t.Error("root after Reset differs from the first one")
+	}
+	legacy := New(testSplitSize)
+	legacy.Write(data)
+	want := NewStream(testSplitSize, mtree.Legacy)
+	want.Write(data)
+	if !bytes.Equal(legacy.Sum(nil), want.Sum(nil)) {
+		t.Error("New does not use the legacy hasher")
+	}
+}
+
+func TestNewStreamRejectsInvalidSplitSize(t *testing.T) {
+	for _, splitSize := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewStream(%d) did not panic", splitSize)
+				}
+			}()
+			NewStream(splitSize, mtree.Legacy)
+		}()
+	}
+}
@@ -0,0 +1,37 @@
+// Package merkletest provides helpers shared by the tests of the
+// packages that split data into chunks and hash it into trees.
+package merkletest
+
+import (
+	"math/rand/v2"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Sizes returns data sizes around the chunk boundaries of chunkSize:
+// empty, a single byte, one byte either side of a whole chunk, and
+// several chunks both with and without a partial final chunk.
+func Sizes(chunkSize int) []int {
+	return []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 5*chunkSize + 3, 16 * chunkSize}
+}
+
+// Data returns size pseudo-random bytes, the same for every run.
+func Data(size int) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, size)
+	for idx := range data {
+		data[idx] = byte(rng.Uint32())
+	}
+	return data
+}
+
+// Tree splits data into chunkSize chunks and
+// adds each of them to a new tree with [mtree.Tree.AddData].
+func Tree(h mtree.Hasher, data []byte, chunkSize int) *mtree.Tree {
+	tree := mtree.NewEmpty()
+	tree.Hasher = h
+	for start := 0; start < len(data); start += chunkSize {
+		tree.AddData(data[start:min(start+chunkSize, len(data))])
+	}
+	return tree
+}
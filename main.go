@@ -15,8 +15,12 @@ import (
 
 var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
-	filePath   = flag.String("f", "", "write cpu profile to file")
-	ver        = flag.String("v", "harr", "Specify file hashing strategy. Use 'old' for tree insertion strategy.")
+	filePath   = flag.String("f", "", "File or directory to hash. Use '-' to hash stdin.")
+	ver        = flag.String("v", "harr", "Specify file hashing strategy. Use 'old' for tree insertion strategy, 'stream' to only compute the root, 'cdc' for content-defined chunks of 256-8192 bytes, or 'cmp' to check that every strategy produces the same root.")
+	domainSep  = flag.Bool("ds", false, "Use domain separated (RFC 6962) leaf and interior hashing.")
+	sizes      = flag.Bool("sizes", false, "Print the size of each tree encoding.")
+	algName    = flag.String("alg", "sha256", "Hash algorithm. One of sha256, sha512_256, sha3_256, blake2b_256 or fnv128a.")
+	workers    = flag.Int("workers", 0, "Number of goroutines hashing chunks concurrently. Defaults to the number of CPUs.")
 )
 
 func main() {
@@ -33,17 +37,63 @@ func main() {
 	if *filePath == "" {
 		log.Fatal("You must include a file to hash using the -f parameter. Ex: go run main.go -f <filepath>")
 	}
-	if _, err := os.Stat(*filePath); errors.Is(err, os.ErrNotExist) {
-		log.Fatal("File does not exist.")
+	if *filePath != "-" {
+		if _, err := os.Stat(*filePath); errors.Is(err, os.ErrNotExist) {
+			log.Fatal("File does not exist.")
+			return
+			// path/to/whatever does not exist
+		}
+	}
+	alg, err := mtree.ParseAlgorithm(*algName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hasher := mtree.Hasher{Algorithm: alg, DomainSeparated: *domainSep}
+	if stat, err := os.Stat(*filePath); err == nil && stat.IsDir() {
+		dir, err := verify.HashDir(*filePath, 1024, verify.WithHasher(hasher), verify.WithWorkers(*workers))
+		if err != nil {
+			log.Fatal("Error hashing directory: ", err.Error())
+		}
+		fmt.Printf("\nHash: %s\n", base64.RawStdEncoding.EncodeToString(dir.RootHash()))
+		return
+	}
+	if *ver == "cmp" {
+		if err := verify.HashFileCmp(*filePath, 1024, verify.WithHasher(hasher), verify.WithWorkers(*workers)); err != nil {
+			log.Fatal("Strategies disagree:\n", err.Error())
+		}
+		fmt.Println("\nAll strategies produce the same root")
+		return
+	}
+	if *ver == "stream" {
+		var rootHash []byte
+		if *filePath == "-" {
+			rootHash, err = verify.HashReaderStream(os.Stdin, 1024, verify.WithHasher(hasher))
+		} else {
+			rootHash, err = verify.HashFileStream(*filePath, 1024, verify.WithHasher(hasher))
+		}
+		if err != nil {
+			log.Fatal("Error hashing file: ", err.Error())
+		}
+		fmt.Printf("\nHash: %s\n", base64.RawStdEncoding.EncodeToString(rootHash))
 		return
-		// path/to/whatever does not exist
 	}
 	var controlTree *mtree.Tree
-	var err error
-	if *ver == "harr" {
-		controlTree, err = verify.HashFileHarr(*filePath, 1024)
+	if *ver == "cdc" {
+		var chunks []verify.Chunk
+		if *filePath == "-" {
+			controlTree, chunks, err = verify.HashReaderCDC(os.Stdin, 256, 1024, 8192, verify.WithHasher(hasher))
+		} else {
+			controlTree, chunks, err = verify.HashFileCDC(*filePath, 256, 1024, 8192, verify.WithHasher(hasher))
+		}
+		if err == nil {
+			fmt.Printf("Chunks: %d\n", len(chunks))
+		}
+	} else if *filePath == "-" {
+		controlTree, err = verify.HashReader(os.Stdin, 1024, verify.WithHasher(hasher))
+	} else if *ver == "harr" {
+		controlTree, err = verify.HashFileHarr(*filePath, 1024, verify.WithHasher(hasher), verify.WithWorkers(*workers))
 	} else {
-		controlTree, err = verify.HashFileLargeReadBuffer(*filePath, 1024)
+		controlTree, err = verify.HashFileLargeReadBuffer(*filePath, 1024, verify.WithHasher(hasher))
 	}
 	if err != nil {
 		fmt.Println("Error hashing file:", err.Error())
@@ -57,7 +107,21 @@ func main() {
 		fmt.Println(err.Error())
 		return
 	}
+	if *sizes {
+		printEncodingSizes(controlTree)
+	}
 	// fmt.Println("Comparing trees...")
 	// fmt.Printf("Trees are equal: %t", mtree.DeepEquals(controlTree, treeFromArr))
 	fmt.Printf("\nHash: %s\n", base64.RawStdEncoding.EncodeToString(controlTree.RootHash()))
 }
+
+// printEncodingSizes compares the size of each tree encoding.
+func printEncodingSizes(tree *mtree.Tree) {
+	compact := len(tree.EncodeCompact())
+	tree.TrimLeaves()
+	fmt.Println()
+	fmt.Printf("Leaves:         %d\n", tree.LeafCount())
+	fmt.Printf("ToArray:        %d bytes\n", len(tree.ToArray()))
+	fmt.Printf("Encode:         %d bytes\n", len(tree.Encode()))
+	fmt.Printf("EncodeCompact:  %d bytes\n", compact)
+}
@@ -0,0 +1,145 @@
+package mtree
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Algorithm identifies the hash function used by a [Hasher].
+// The zero value is [SHA256].
+type Algorithm uint8
+
+const (
+	SHA256 Algorithm = iota
+	SHA512_256
+	SHA3_256
+	BLAKE2b_256
+	// FNV128a is not cryptographically secure. It is only
+	// suitable for deduplication of trusted data.
+	FNV128a
+)
+
+type algorithmInfo struct {
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+var algorithms = []algorithmInfo{
+	SHA256:     {"sha256", sha256.Size, sha256.New},
+	SHA512_256: {"sha512_256", sha512.Size256, sha512.New512_256},
+	SHA3_256:   {"sha3_256", 32, sha3.New256},
+	BLAKE2b_256: {"blake2b_256", blake2b.Size256, func() hash.Hash {
+		// Only fails when given a key that is too long
+		d, _ := blake2b.New256(nil)
+		return d
+	}},
+	FNV128a: {"fnv128a", 16, fnv.New128a},
+}
+
+// FirstCustomAlgorithm is the lowest identifier that can be passed to
+// [RegisterAlgorithm]. Lower identifiers are reserved for this package.
+const FirstCustomAlgorithm Algorithm = 128
+
+var (
+	customMu   sync.RWMutex
+	customAlgs = map[Algorithm]algorithmInfo{}
+)
+
+// RegisterAlgorithm adds a hash function that can be used by a [Hasher]
+// under the given identifier, which must be at least
+// [FirstCustomAlgorithm]. The identifier is written into encoded trees,
+// so it must stay the same for as long as those trees are kept. size
+// must match the length of the digest returned by the hash.Hash values
+// that newHash creates, and be at most 255 bytes.
+func RegisterAlgorithm(id Algorithm, name string, size int, newHash func() hash.Hash) error {
+	if id < FirstCustomAlgorithm {
+		return fmt.Errorf("algorithm identifier %d is reserved, use %d or above", id, FirstCustomAlgorithm)
+	}
+	// The digest size is stored in a single byte of encoded trees
+	if size < 1 || size > math.MaxUint8 || newHash == nil {
+		return fmt.Errorf("algorithm %q needs a digest size of 1 to %d bytes and a hash function", name, math.MaxUint8)
+	}
+	customMu.Lock()
+	defer customMu.Unlock()
+	if info, ok := customAlgs[id]; ok {
+		return fmt.Errorf("algorithm identifier %d is already registered as %q", id, info.name)
+	}
+	if _, err := parseAlgorithm(name); err == nil {
+		return fmt.Errorf("algorithm %q is already registered", name)
+	}
+	customAlgs[id] = algorithmInfo{name, size, newHash}
+	return nil
+}
+
+// ParseAlgorithm returns the algorithm with the given name.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	return parseAlgorithm(name)
+}
+
+// parseAlgorithm is ParseAlgorithm with customMu held.
+func parseAlgorithm(name string) (Algorithm, error) {
+	for idx, info := range algorithms {
+		if strings.EqualFold(info.name, name) {
+			return Algorithm(idx), nil
+		}
+	}
+	for id, info := range customAlgs {
+		if strings.EqualFold(info.name, name) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash algorithm %q", name)
+}
+
+func (a Algorithm) lookup() (algorithmInfo, bool) {
+	if int(a) < len(algorithms) {
+		return algorithms[a], true
+	}
+	customMu.RLock()
+	defer customMu.RUnlock()
+	info, ok := customAlgs[a]
+	return info, ok
+}
+
+func (a Algorithm) known() bool {
+	_, ok := a.lookup()
+	return ok
+}
+
+func (a Algorithm) info() algorithmInfo {
+	info, ok := a.lookup()
+	if !ok {
+		panic(fmt.Sprintf("mtree: unknown hash algorithm %d", a))
+	}
+	return info
+}
+
+// Size returns the digest length of the algorithm in bytes.
+func (a Algorithm) Size() int {
+	return a.info().size
+}
+
+// New returns a new hash.Hash computing the algorithm's digest.
+func (a Algorithm) New() hash.Hash {
+	return a.info().new()
+}
+
+func (a Algorithm) String() string {
+	info, ok := a.lookup()
+	if !ok {
+		return fmt.Sprintf("Algorithm(%d)", a)
+	}
+	return info.name
+}
@@ -0,0 +1,67 @@
+package mtree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	for _, alg := range []Algorithm{SHA256, SHA512_256, SHA3_256, BLAKE2b_256, FNV128a} {
+		if got := alg.New().Size(); got != alg.Size() {
+			t.Errorf("%v: New().Size() = %d, Size() = %d", alg, got, alg.Size())
+		}
+		parsed, err := ParseAlgorithm(alg.String())
+		if err != nil || parsed != alg {
+			t.Errorf("ParseAlgorithm(%q) = %v, %v", alg.String(), parsed, err)
+		}
+		h := Hasher{Algorithm: alg, DomainSeparated: true}
+		if got := len(buildTree(h, testData(5)).RootHash()); got != alg.Size() {
+			t.Errorf("%v: root has %d bytes, want %d", alg, got, alg.Size())
+		}
+	}
+	if _, err := ParseAlgorithm("md5"); err == nil {
+		t.Error("ParseAlgorithm accepted an unknown algorithm")
+	}
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	newHash := func() hash.Hash { return sha256.New224() }
+	alg := FirstCustomAlgorithm + 1
+	if err := RegisterAlgorithm(alg, "test_sha224", sha256.Size224, newHash); err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := ParseAlgorithm("test_sha224"); err != nil || parsed != alg {
+		t.Errorf("ParseAlgorithm of a registered algorithm = %v, %v", parsed, err)
+	}
+	h := Hasher{Algorithm: alg, DomainSeparated: true}
+	chunks := testData(7)
+	tree := buildTree(h, chunks)
+	if !bytes.Equal(tree.RootHash(), referenceRoot(h, chunks)) {
+		t.Error("root of a tree with a registered algorithm does not match RFC 6962")
+	}
+
+	invalid := []struct {
+		id   Algorithm
+		name string
+		size int
+	}{
+		{alg, "test_other", sha256.Size224},
+		{FirstCustomAlgorithm + 2, "test_sha224", sha256.Size224},
+		{FirstCustomAlgorithm + 2, "sha256", sha256.Size},
+		{SHA256, "test_reserved", sha256.Size},
+		{FirstCustomAlgorithm - 1, "test_reserved", sha256.Size},
+		{FirstCustomAlgorithm + 2, "test_empty", 0},
+		{FirstCustomAlgorithm + 2, "test_negative", -1},
+		{FirstCustomAlgorithm + 2, "test_huge", 256},
+	}
+	for _, test := range invalid {
+		if err := RegisterAlgorithm(test.id, test.name, test.size, newHash); err == nil {
+			t.Errorf("RegisterAlgorithm(%d, %q, %d) succeeded", test.id, test.name, test.size)
+		}
+	}
+	if alg.String() != "test_sha224" {
+		t.Errorf("a failed registration replaced %v", alg)
+	}
+}
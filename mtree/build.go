@@ -0,0 +1,65 @@
+package mtree
+
+// FromLeafHashes builds a tree from already computed leaf hashes,
+// pairing nodes from the leaves up in the same way as
+// hash.HashArray.BuildTree. The resulting tree has the same
+// shape and root as one built by [Tree.AddData].
+func FromLeafHashes(leafHashes [][]byte, h Hasher) *Tree {
+	tree := NewEmpty()
+	tree.Hasher = h
+	if len(leafHashes) == 0 {
+		return tree
+	}
+	level := make([]*Node, len(leafHashes))
+	for idx, leafHash := range leafHashes {
+		level[idx] = &Node{Val: leafHash, depth: 1}
+	}
+	for len(level) > 1 {
+		next := level[:0]
+		for i := 0; i+1 < len(level); i += 2 {
+			nL, nR := level[i], level[i+1]
+			next = append(next, &Node{
+				Val:   cat(h.nodeHash(nL), h.nodeHash(nR)),
+				Left:  nL,
+				Right: nR,
+			})
+		}
+		// An odd node is promoted to the next level
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+	tree.Root = level[0]
+	return tree
+}
+
+// FromLeafSpans builds a tree like [FromLeafHashes] for chunks that
+// are not uniformly sized, where each leaf records the span of its
+// chunk. Chunks must be contiguous, starting at offset 0.
+func FromLeafSpans(leafHashes [][]byte, lengths []int64, h Hasher) (*Tree, error) {
+	tree := FromLeafHashes(leafHashes, h)
+	if err := tree.setSpans(lengths); err != nil {
+		return nil, err
+	}
+	tree.Length = tree.ByteLength()
+	return tree, nil
+}
+
+// LeafHashes returns the hash of every leaf in order.
+// This also works for trees that have had [Tree.TrimLeaves] called on them.
+func (t Tree) LeafHashes() [][]byte {
+	if t.Root == nil {
+		return nil
+	}
+	hashes := make([][]byte, 0, t.LeafCount())
+	return t.rootSubtree().appendLeafHashes(hashes)
+}
+
+func (s subtree) appendLeafHashes(hashes [][]byte) [][]byte {
+	if s.leaves == 1 {
+		return append(hashes, s.hash)
+	}
+	left, right := s.children()
+	return right.appendLeafHashes(left.appendLeafHashes(hashes))
+}
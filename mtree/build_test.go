@@ -0,0 +1,33 @@
+package mtree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFromLeafHashes(t *testing.T) {
+	for _, h := range testHashers {
+		for n := 0; n <= 33; n++ {
+			chunks := testData(n)
+			leafHashes := make([][]byte, n)
+			for idx, chunk := range chunks {
+				leafHashes[idx] = h.Leaf(chunk)
+			}
+			tree := FromLeafHashes(leafHashes, h)
+			added := buildTree(h, chunks)
+			if !bytes.Equal(tree.RootHash(), added.RootHash()) {
+				t.Errorf("%v, %d leaves: root differs from AddData", h, n)
+			}
+			added.TrimLeaves()
+			got := added.LeafHashes()
+			if len(got) != n {
+				t.Fatalf("%v: LeafHashes() of trimmed tree returned %d hashes, want %d", h, len(got), n)
+			}
+			for idx := range got {
+				if !bytes.Equal(got[idx], leafHashes[idx]) {
+					t.Errorf("%v, %d leaves: leaf hash %d differs", h, n, idx)
+				}
+			}
+		}
+	}
+}
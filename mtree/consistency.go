@@ -0,0 +1,104 @@
+package mtree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ConsistencyProof proves that a tree with OldSize leaves
+// is a prefix of a tree with NewSize leaves, following
+// the semantics of RFC 6962 (and RFC 9162) section 2.1.4.
+type ConsistencyProof struct {
+	OldSize int      `json:"oldSize"`
+	NewSize int      `json:"newSize"`
+	Path    [][]byte `json:"path"`
+}
+
+// ConsistencyProof returns a proof that the first oldSize
+// leaves of the tree form the tree they did when it only
+// had oldSize leaves. Since [Tree.AddData] only ever appends
+// leaves, this lets a client holding an old root check
+// that the data was only appended to.
+func (t Tree) ConsistencyProof(oldSize int) (*ConsistencyProof, error) {
+	if t.Root == nil {
+		return nil, fmt.Errorf("cannot build consistency proof for empty tree")
+	}
+	root := t.rootSubtree()
+	if oldSize < 1 || oldSize > root.leaves {
+		return nil, fmt.Errorf("old size %d out of range, tree has %d leaves", oldSize, root.leaves)
+	}
+	return &ConsistencyProof{
+		OldSize: oldSize,
+		NewSize: root.leaves,
+		Path:    subproof(oldSize, root, true),
+	}, nil
+}
+
+// subproof implements SUBPROOF from RFC 6962 section 2.1.2.
+// complete is true when the subtree of the first m leaves
+// is a subtree of the old tree, so the verifier already knows its hash.
+func subproof(m int, s subtree, complete bool) [][]byte {
+	if m == s.leaves {
+		if complete {
+			return nil
+		}
+		return [][]byte{s.hash}
+	}
+	left, right := s.children()
+	if m <= left.leaves {
+		return append(subproof(m, left, complete), right.hash)
+	}
+	return append(subproof(m-left.leaves, right, false), left.hash)
+}
+
+// VerifyConsistency checks that the tree with oldRoot is
+// a prefix of the tree with newRoot using the given proof.
+// Trees built with a non-default hasher should use [Hasher.VerifyConsistency].
+func VerifyConsistency(oldRoot, newRoot []byte, proof *ConsistencyProof) bool {
+	return Legacy.VerifyConsistency(oldRoot, newRoot, proof)
+}
+
+// VerifyConsistency checks that the tree with oldRoot is
+// a prefix of the tree with newRoot using the given proof.
+// This follows the verification algorithm of RFC 9162 section 2.1.4.2.
+func (h Hasher) VerifyConsistency(oldRoot, newRoot []byte, proof *ConsistencyProof) bool {
+	if proof == nil || proof.OldSize < 1 || proof.OldSize > proof.NewSize {
+		return false
+	}
+	if proof.OldSize == proof.NewSize {
+		return len(proof.Path) == 0 && bytes.Equal(oldRoot, newRoot)
+	}
+	path := proof.Path
+	// When the old tree is perfect its root is
+	// a node of the new tree and is left out of the proof
+	if proof.OldSize&(proof.OldSize-1) == 0 {
+		path = append([][]byte{oldRoot}, path...)
+	}
+	if len(path) == 0 {
+		return false
+	}
+	fn, sn := proof.OldSize-1, proof.NewSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = h.Interior(cat(c, fr))
+			sr = h.Interior(cat(c, sr))
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = h.Interior(cat(sr, c))
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, oldRoot) && bytes.Equal(sr, newRoot)
+}
@@ -0,0 +1,94 @@
+package mtree
+
+import "testing"
+
+func TestConsistencyProof(t *testing.T) {
+	for _, h := range testHashers {
+		for n := 1; n <= 20; n++ {
+			chunks := testData(n)
+			tree := buildTree(h, chunks)
+			newRoot := tree.RootHash()
+			for m := 1; m <= n; m++ {
+				oldRoot := referenceRoot(h, chunks[:m])
+				proof, err := tree.ConsistencyProof(m)
+				if err != nil {
+					t.Fatalf("%v: ConsistencyProof(%d) of %d leaves: %v", h, m, n, err)
+				}
+				if proof.OldSize != m || proof.NewSize != n {
+					t.Errorf("ConsistencyProof(%d) of %d leaves has sizes %d, %d", m, n, proof.OldSize, proof.NewSize)
+				}
+				if !h.VerifyConsistency(oldRoot, newRoot, proof) {
+					t.Errorf("%v: proof from %d to %d leaves does not verify", h, m, n)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistencyProofRejectsTampering(t *testing.T) {
+	for _, h := range testHashers {
+		for n := 2; n <= 12; n++ {
+			chunks := testData(n)
+			tree := buildTree(h, chunks)
+			newRoot := tree.RootHash()
+			for m := 1; m < n; m++ {
+				oldRoot := referenceRoot(h, chunks[:m])
+				proof, err := tree.ConsistencyProof(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// A tree that was modified rather than appended to
+				forked := append(testData(m-1), []byte("forked"))
+				if h.VerifyConsistency(referenceRoot(h, forked), newRoot, proof) {
+					t.Errorf("%v: %d to %d leaves: verifies a modified old tree", h, m, n)
+				}
+				if h.VerifyConsistency(oldRoot, oldRoot, proof) {
+					t.Errorf("%v: %d to %d leaves: verifies the wrong new root", h, m, n)
+				}
+				for idx := range proof.Path {
+					tampered := cloneConsistencyProof(proof)
+					tampered.Path[idx][0] ^= 1
+					if h.VerifyConsistency(oldRoot, newRoot, tampered) {
+						t.Errorf("%v: %d to %d leaves: verifies with node %d tampered", h, m, n, idx)
+					}
+				}
+				if len(proof.Path) > 0 {
+					short := cloneConsistencyProof(proof)
+					short.Path = short.Path[:len(short.Path)-1]
+					if h.VerifyConsistency(oldRoot, newRoot, short) {
+						t.Errorf("%v: %d to %d leaves: verifies with a node missing", h, m, n)
+					}
+				}
+				long := cloneConsistencyProof(proof)
+				long.Path = append(long.Path, h.Leaf([]byte("extra")))
+				if h.VerifyConsistency(oldRoot, newRoot, long) {
+					t.Errorf("%v: %d to %d leaves: verifies with an extra node", h, m, n)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistencyProofOutOfRange(t *testing.T) {
+	tree := buildTree(DomainSeparated, testData(4))
+	for _, m := range []int{-1, 0, 5} {
+		if _, err := tree.ConsistencyProof(m); err == nil {
+			t.Errorf("ConsistencyProof(%d) of 4 leaves succeeded", m)
+		}
+	}
+	if _, err := NewEmpty().ConsistencyProof(1); err == nil {
+		t.Error("ConsistencyProof(1) of an empty tree succeeded")
+	}
+	if DomainSeparated.VerifyConsistency(tree.RootHash(), tree.RootHash(), nil) {
+		t.Error("nil proof verifies")
+	}
+}
+
+func cloneConsistencyProof(p *ConsistencyProof) *ConsistencyProof {
+	clone := *p
+	clone.Path = make([][]byte, len(p.Path))
+	for idx, hash := range p.Path {
+		clone.Path[idx] = append([]byte{}, hash...)
+	}
+	return &clone
+}
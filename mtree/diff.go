@@ -0,0 +1,95 @@
+package mtree
+
+import "bytes"
+
+// LeafRange is a half-open range [Start, End) of leaf indexes.
+type LeafRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Len returns the number of leaves in the range.
+func (r LeafRange) Len() int {
+	return r.End - r.Start
+}
+
+// Split returns the leaves below the left and right children of
+// the node that covers r, in a tree shaped like [Tree.AddData] builds
+// them. r must hold more than one leaf.
+func (r LeafRange) Split() (left, right LeafRange) {
+	mid := r.Start + splitPoint(r.Len())
+	return LeafRange{Start: r.Start, End: mid}, LeafRange{Start: mid, End: r.End}
+}
+
+// ByteRange returns the half-open range of bytes covered by the leaves,
+// for data split into chunkSize chunks. The end is clamped to length,
+// since the final chunk may be short.
+func (r LeafRange) ByteRange(chunkSize int, length int64) (start, end int64) {
+	start = int64(r.Start) * int64(chunkSize)
+	end = min(int64(r.End)*int64(chunkSize), length)
+	return start, end
+}
+
+// Diff walks two trees from the root down, skipping every pair of
+// subtrees with matching hashes, and returns the ranges of leaves that
+// differ in increasing order. Adjacent ranges are merged. If the trees
+// have a different number of leaves, the leaves only present in the
+// larger tree are included. Trees built with different hashers differ
+// everywhere.
+func Diff(t1, t2 *Tree) []LeafRange {
+	n1, n2 := t1.LeafCount(), t2.LeafCount()
+	if n1 == 0 || n2 == 0 || t1.Hasher != t2.Hasher {
+		return addRange(nil, 0, max(n1, n2))
+	}
+	return diffSubtrees(t1.rootSubtree(), t2.rootSubtree(), 0, nil)
+}
+
+// diffSubtrees appends the differing leaf ranges of two subtrees
+// that both start at leaf index lo.
+func diffSubtrees(a, b subtree, lo int, ranges []LeafRange) []LeafRange {
+	if a.leaves == b.leaves && bytes.Equal(a.hash, b.hash) {
+		return ranges
+	}
+	if a.leaves == 1 && b.leaves == 1 {
+		return addRange(ranges, lo, lo+1)
+	}
+	ka, kb := leftLeaves(a.leaves), leftLeaves(b.leaves)
+	switch {
+	case ka == kb:
+		aL, aR := a.children()
+		bL, bR := b.children()
+		ranges = diffSubtrees(aL, bL, lo, ranges)
+		return diffSubtrees(aR, bR, lo+ka, ranges)
+	case ka > kb:
+		// All of b lines up with the left child of a
+		aL, _ := a.children()
+		ranges = diffSubtrees(aL, b, lo, ranges)
+		return addRange(ranges, lo+ka, lo+a.leaves)
+	default:
+		bL, _ := b.children()
+		ranges = diffSubtrees(a, bL, lo, ranges)
+		return addRange(ranges, lo+kb, lo+b.leaves)
+	}
+}
+
+// leftLeaves returns the number of leaves in the left
+// child of a subtree, or 0 if the subtree is a single leaf.
+func leftLeaves(leaves int) int {
+	if leaves == 1 {
+		return 0
+	}
+	return splitPoint(leaves)
+}
+
+// addRange appends [start, end) to ranges,
+// merging it with the last range if they touch.
+func addRange(ranges []LeafRange, start, end int) []LeafRange {
+	if start >= end {
+		return ranges
+	}
+	if last := len(ranges) - 1; last >= 0 && ranges[last].End >= start {
+		ranges[last].End = max(ranges[last].End, end)
+		return ranges
+	}
+	return append(ranges, LeafRange{Start: start, End: end})
+}
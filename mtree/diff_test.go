@@ -0,0 +1,76 @@
+package mtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+// referenceDiff compares every leaf of two lists of
+// chunks and returns the merged ranges that differ.
+func referenceDiff(a, b [][]byte) []LeafRange {
+	var ranges []LeafRange
+	for idx := range max(len(a), len(b)) {
+		if idx < len(a) && idx < len(b) && string(a[idx]) == string(b[idx]) {
+			continue
+		}
+		ranges = addRange(ranges, idx, idx+1)
+	}
+	return ranges
+}
+
+func TestDiff(t *testing.T) {
+	for _, h := range testHashers {
+		for n1 := 0; n1 <= 17; n1++ {
+			for n2 := 0; n2 <= 17; n2++ {
+				for _, changed := range [][]int{nil, {0}, {n1 - 1}, {1, 2}, {0, n1 / 2, n1 - 1}} {
+					a := testData(n1)
+					b := testData(n2)
+					for _, idx := range changed {
+						if idx >= 0 && idx < n2 {
+							b[idx] = []byte("changed")
+						}
+					}
+					want := referenceDiff(a, b)
+					ta, tb := buildTree(h, a), buildTree(h, b)
+					if got := Diff(ta, tb); !reflect.DeepEqual(got, want) {
+						t.Errorf("%v: Diff of %d and %d leaves, changed %v = %v, want %v", h, n1, n2, changed, got, want)
+					}
+					ta.TrimLeaves()
+					tb.TrimLeaves()
+					if got := Diff(ta, tb); !reflect.DeepEqual(got, want) {
+						t.Errorf("%v: Diff of trimmed trees of %d and %d leaves, changed %v = %v, want %v", h, n1, n2, changed, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDiffDifferentHashers(t *testing.T) {
+	chunks := testData(6)
+	got := Diff(buildTree(Legacy, chunks), buildTree(DomainSeparated, chunks))
+	if want := []LeafRange{{Start: 0, End: 6}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff of trees with different hashers = %v, want %v", got, want)
+	}
+}
+
+func TestLeafRangeSplit(t *testing.T) {
+	for n := 2; n <= 33; n++ {
+		visited := map[LeafRange]bool{}
+		err := buildTree(DomainSeparated, testData(n)).Walk(func(leaves LeafRange, children []byte) error {
+			visited[leaves] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r := range visited {
+			if r.Len() == 1 {
+				continue
+			}
+			if left, right := r.Split(); !visited[left] || !visited[right] || left.End != right.Start {
+				t.Errorf("%d leaves: %v splits into %v and %v, which are not its children", n, r, left, right)
+			}
+		}
+	}
+}
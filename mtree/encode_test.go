@@ -0,0 +1,237 @@
+package mtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+const testChunkSize = 8
+
+// buildSizedTree builds a tree of n chunks whose ChunkSize
+// and Length are set, where the last chunk is partial.
+func buildSizedTree(h Hasher, n int) *Tree {
+	tree := buildTree(h, testData(n))
+	tree.ChunkSize = testChunkSize
+	if n > 0 {
+		tree.Length = int64(n*testChunkSize - 3)
+	}
+	return tree
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, h := range testHashers {
+		for _, n := range []int{0, 1, 2, 3, 5, 8, 13, 33} {
+			tree := buildSizedTree(h, n)
+			trimmed := tree.Clone()
+			trimmed.TrimLeaves()
+			encodings := map[string][]byte{
+				"Encode":         tree.Encode(),
+				"trimmed Encode": trimmed.Encode(),
+				"EncodeCompact":  tree.EncodeCompact(),
+			}
+			for name, arr := range encodings {
+				decoded, hdr, err := Decode(arr)
+				if err != nil {
+					t.Fatalf("%v, %d leaves: Decode(%s): %v", h, n, name, err)
+				}
+				want := Header{
+					Version:   Version,
+					Hasher:    h,
+					ChunkSize: testChunkSize,
+					Length:    tree.Length,
+					Leaves:    n,
+					Compact:   name == "EncodeCompact",
+				}
+				if hdr != want {
+					t.Errorf("%v, %d leaves: %s header = %+v, want %+v", h, n, name, hdr, want)
+				}
+				reencoded := decoded.Encode()
+				if hdr.Compact {
+					reencoded = decoded.EncodeCompact()
+				}
+				if !bytes.Equal(reencoded, arr) {
+					t.Errorf("%v, %d leaves: %s does not round trip", h, n, name)
+				}
+				if !bytes.Equal(decoded.RootHash(), tree.RootHash()) {
+					t.Errorf("%v, %d leaves: %s decodes to a different root", h, n, name)
+				}
+				if decoded.ChunkSize != tree.ChunkSize || decoded.Length != tree.Length {
+					t.Errorf("%s: decoded tree has ChunkSize %d, Length %d", name, decoded.ChunkSize, decoded.Length)
+				}
+			}
+		}
+	}
+}
+
+// TestEncodeUnknownLength checks that trees whose ChunkSize and
+// Length were never set still round trip.
+func TestEncodeUnknownLength(t *testing.T) {
+	for _, n := range []int{0, 1, 5, 13} {
+		tree := buildTree(DomainSeparated, testData(n))
+		for _, arr := range [][]byte{tree.Encode(), tree.EncodeCompact()} {
+			decoded, hdr, err := Decode(arr)
+			if err != nil {
+				t.Fatalf("%d leaves: Decode: %v", n, err)
+			}
+			if hdr.ChunkSize != 0 || hdr.Length != 0 || hdr.Leaves != n {
+				t.Errorf("%d leaves: header = %+v", n, hdr)
+			}
+			if !bytes.Equal(decoded.RootHash(), tree.RootHash()) {
+				t.Errorf("%d leaves: decoded to a different root", n)
+			}
+		}
+	}
+}
+
+func TestDecodeLegacyArray(t *testing.T) {
+	for _, n := range []int{2, 3, 5, 8} {
+		tree := buildTree(Legacy, testData(n))
+		tree.TrimLeaves()
+		decoded, hdr, err := Decode(tree.ToArray())
+		if err != nil {
+			t.Fatalf("%d leaves: %v", n, err)
+		}
+		if hdr.Version != 0 || hdr.Leaves != n {
+			t.Errorf("%d leaves: header = %+v", n, hdr)
+		}
+		if !bytes.Equal(decoded.RootHash(), tree.RootHash()) {
+			t.Errorf("%d leaves: legacy array does not round trip", n)
+		}
+	}
+}
+
+func TestEncodeSpans(t *testing.T) {
+	lengths := []int64{3, 10, 1, 7, 12}
+	chunks := testData(len(lengths))
+	hashes := make([][]byte, len(chunks))
+	for idx, chunk := range chunks {
+		hashes[idx] = DomainSeparated.Leaf(chunk)
+	}
+	tree, err := FromLeafSpans(hashes, lengths, DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.ChunkSize != 0 || tree.Length != 33 {
+		t.Errorf("FromLeafSpans tree has ChunkSize %d, Length %d", tree.ChunkSize, tree.Length)
+	}
+	for _, arr := range [][]byte{tree.Encode(), tree.EncodeCompact()} {
+		decoded, hdr, err := Decode(arr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.Spans || hdr.ChunkSize != 0 || hdr.Length != 33 {
+			t.Errorf("header = %+v", hdr)
+		}
+		if !bytes.Equal(decoded.RootHash(), tree.RootHash()) {
+			t.Error("tree with spans does not round trip")
+		}
+		got, want := decoded.LeafSpans(), tree.LeafSpans()
+		if len(got) != len(want) {
+			t.Fatalf("decoded %d spans, want %d", len(got), len(want))
+		}
+		for idx := range want {
+			if got[idx] != want[idx] {
+				t.Errorf("span %d = %v, want %v", idx, got[idx], want[idx])
+			}
+		}
+	}
+	arr := tree.Encode()
+	binary.BigEndian.PutUint64(arr[12:], 34)
+	if _, _, err := Decode(withChecksum(arr)); err == nil {
+		t.Error("Decode accepted spans that do not add up to the length")
+	}
+}
+
+func TestDecodeRejectsCorruption(t *testing.T) {
+	tree := buildSizedTree(DomainSeparated, 5)
+	for _, arr := range [][]byte{tree.Encode(), tree.EncodeCompact()} {
+		// Flipping a bit of the magic makes it a legacy array, skip it
+		for idx := len(magic); idx < len(arr); idx++ {
+			corrupt := bytes.Clone(arr)
+			corrupt[idx] ^= 0x10
+			if _, _, err := Decode(corrupt); err == nil {
+				t.Errorf("Decode succeeded with byte %d corrupted", idx)
+			}
+		}
+		for end := len(magic); end < len(arr); end++ {
+			if _, _, err := Decode(arr[:end]); err == nil {
+				t.Errorf("Decode succeeded when truncated to %d of %d bytes", end, len(arr))
+			}
+		}
+	}
+}
+
+// TestDecodeRejectsMalformedTrees checks trees that keep the real
+// root hash and leaf count but cannot be walked by leaf index.
+func TestDecodeRejectsMalformedTrees(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(root *Node)
+	}{
+		{"missing subtree", func(root *Node) { root.Left.Right = nil }},
+		{"subtree as a leaf", func(root *Node) {
+			root.Left.Right = &Node{Val: DomainSeparated.nodeHash(root.Left.Right)}
+		}},
+		{"swapped subtrees", func(root *Node) { root.Left.Left, root.Left.Right = root.Left.Right, root.Left.Left }},
+		{"leaf hash", func(root *Node) { root.Right.Right.Left.Val = DomainSeparated.Leaf([]byte("other")) }},
+	}
+	for _, test := range tests {
+		tree := buildSizedTree(DomainSeparated, 8)
+		root := tree.RootHash()
+		test.modify(tree.Root)
+		if !bytes.Equal(tree.RootHash(), root) || tree.LeafCount() != 8 {
+			t.Fatalf("%s: modified tree changed its root or leaf count", test.name)
+		}
+		if _, _, err := Decode(tree.Encode()); err == nil {
+			t.Errorf("%s: Decode succeeded", test.name)
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidHeaders(t *testing.T) {
+	tree := buildSizedTree(DomainSeparated, 5)
+	tests := []struct {
+		name   string
+		modify func(arr []byte)
+	}{
+		{"version", func(arr []byte) { arr[4] = Version + 1 }},
+		{"unknown algorithm", func(arr []byte) { arr[5] = 127 }},
+		{"digest size", func(arr []byte) { arr[7] = 16 }},
+		{"chunk size", func(arr []byte) { binary.BigEndian.PutUint32(arr[8:], testChunkSize*2) }},
+		{"length", func(arr []byte) { binary.BigEndian.PutUint64(arr[12:], 1) }},
+		{"negative length", func(arr []byte) { binary.BigEndian.PutUint64(arr[12:], 1<<63) }},
+		{"extra leaf", func(arr []byte) { binary.BigEndian.PutUint64(arr[20:], 6) }},
+		{"huge leaf count", func(arr []byte) {
+			// Leaves*digest size overflows an int
+			binary.BigEndian.PutUint32(arr[8:], 0)
+			binary.BigEndian.PutUint64(arr[12:], 1<<62)
+			binary.BigEndian.PutUint64(arr[20:], 1<<59+1)
+		}},
+		{"more leaves than bytes", func(arr []byte) {
+			binary.BigEndian.PutUint32(arr[8:], 0)
+			binary.BigEndian.PutUint64(arr[12:], 4)
+		}},
+		{"more leaves than the encoding holds", func(arr []byte) {
+			binary.BigEndian.PutUint32(arr[8:], 0)
+			binary.BigEndian.PutUint64(arr[12:], 0)
+			binary.BigEndian.PutUint64(arr[20:], 1<<63)
+		}},
+	}
+	for _, test := range tests {
+		for _, arr := range [][]byte{tree.Encode(), tree.EncodeCompact()} {
+			test.modify(arr)
+			if _, _, err := Decode(withChecksum(arr)); err == nil {
+				t.Errorf("%s: Decode succeeded", test.name)
+			}
+		}
+	}
+}
+
+// withChecksum replaces the trailing checksum of an encoded tree
+// with a valid one, so the rest of the checks are exercised.
+func withChecksum(arr []byte) []byte {
+	body := arr[:len(arr)-checksumSize]
+	return binary.BigEndian.AppendUint32(body, crc32.Checksum(body, crcTable))
+}
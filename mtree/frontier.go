@@ -0,0 +1,63 @@
+package mtree
+
+// Frontier computes the root hash of a tree one leaf at a time
+// without keeping the tree in memory. It only retains the roots
+// of the perfect subtrees along the right-hand edge of the tree,
+// so memory use is O(log n) in the number of leaves.
+// The root matches the one built by [Tree.AddData].
+type Frontier struct {
+	Hasher Hasher
+	// Hashes of the perfect subtrees along the right edge,
+	// largest first. The size of each subtree is given by
+	// the set bits of leaves.
+	nodes  [][]byte
+	leaves int
+}
+
+// NewFrontier creates an empty frontier using the given hasher.
+func NewFrontier(h Hasher) *Frontier {
+	return &Frontier{Hasher: h}
+}
+
+// AddData adds a leaf with the hash of the given piece of data.
+func (f *Frontier) AddData(val []byte) {
+	f.AddLeaf(f.Hasher.Leaf(val))
+}
+
+// AddLeaf adds a leaf with an already computed leaf hash.
+func (f *Frontier) AddLeaf(leafHash []byte) {
+	f.nodes = append(f.nodes, leafHash)
+	// Every trailing set bit of the old leaf count is
+	// a perfect subtree the same size as the new one.
+	for c := f.leaves; c&1 == 1; c >>= 1 {
+		last := len(f.nodes) - 1
+		f.nodes[last-1] = f.Hasher.Interior(cat(f.nodes[last-1], f.nodes[last]))
+		f.nodes = f.nodes[:last]
+	}
+	f.leaves++
+}
+
+// Leaves returns the number of leaves added so far.
+func (f Frontier) Leaves() int {
+	return f.leaves
+}
+
+// RootHash returns the root hash of the leaves added so far.
+// If no leaves have been added, it returns [Hasher.Empty].
+func (f Frontier) RootHash() []byte {
+	if len(f.nodes) == 0 {
+		return f.Hasher.Empty()
+	}
+	root := f.nodes[len(f.nodes)-1]
+	for i := len(f.nodes) - 2; i >= 0; i-- {
+		root = f.Hasher.Interior(cat(f.nodes[i], root))
+	}
+	return root
+}
+
+// Clone returns a copy of the frontier that
+// can be added to without affecting f.
+func (f Frontier) Clone() *Frontier {
+	f.nodes = append([][]byte(nil), f.nodes...)
+	return &f
+}
@@ -0,0 +1,43 @@
+package mtree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrontierMatchesTree(t *testing.T) {
+	for _, h := range testHashers {
+		f := NewFrontier(h)
+		if !bytes.Equal(f.RootHash(), h.Empty()) {
+			t.Errorf("%v: root of an empty frontier is not the hash of no data", h)
+		}
+		chunks := testData(40)
+		for n, chunk := range chunks {
+			f.AddData(chunk)
+			if f.Leaves() != n+1 {
+				t.Fatalf("Leaves() = %d, want %d", f.Leaves(), n+1)
+			}
+			if want := referenceRoot(h, chunks[:n+1]); !bytes.Equal(f.RootHash(), want) {
+				t.Errorf("%v, %d leaves: root does not match RFC 6962", h, n+1)
+			}
+		}
+	}
+}
+
+func TestFrontierClone(t *testing.T) {
+	chunks := testData(11)
+	f := NewFrontier(DomainSeparated)
+	for _, chunk := range chunks[:6] {
+		f.AddData(chunk)
+	}
+	clone := f.Clone()
+	for _, chunk := range chunks[6:] {
+		clone.AddData(chunk)
+	}
+	if !bytes.Equal(f.RootHash(), referenceRoot(DomainSeparated, chunks[:6])) {
+		t.Error("adding to a clone changed the original")
+	}
+	if !bytes.Equal(clone.RootHash(), referenceRoot(DomainSeparated, chunks)) {
+		t.Error("root of the clone does not match RFC 6962")
+	}
+}
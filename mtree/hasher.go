@@ -0,0 +1,80 @@
+package mtree
+
+const (
+	leafPrefix     = 0x00
+	interiorPrefix = 0x01
+)
+
+// Hasher computes the leaf and interior node hashes of a tree.
+// The zero value uses SHA-256 and hashes leaves and interior
+// nodes identically, as trees were hashed before domain separation
+// was added. It does not reproduce every root computed before the
+// final chunk stopped being padded with zeros, see [Legacy].
+type Hasher struct {
+	Algorithm Algorithm
+	// DomainSeparated prefixes leaf data with 0x00 and interior
+	// node values with 0x01 before hashing (as in RFC 6962), so a
+	// leaf can never be mistaken for an interior node.
+	DomainSeparated bool
+}
+
+var (
+	// Legacy hashes leaves and interior nodes the same way. Roots of
+	// data whose length is not a multiple of the chunk size differ
+	// from those computed by earlier versions, which padded the final
+	// chunk with zeros.
+	Legacy = Hasher{}
+	// DomainSeparated uses RFC 6962 style leaf and interior prefixes.
+	DomainSeparated = Hasher{DomainSeparated: true}
+)
+
+// Leaf returns the leaf hash of the given piece of data.
+func (h Hasher) Leaf(data []byte) []byte {
+	return h.sum(leafPrefix, data)
+}
+
+// Interior returns the hash of an interior node
+// given the concatenated hashes of its children.
+func (h Hasher) Interior(val []byte) []byte {
+	return h.sum(interiorPrefix, val)
+}
+
+// Empty returns the root hash of a tree with no leaves,
+// which is the hash of no data (see RFC 6962 section 2.1).
+func (h Hasher) Empty() []byte {
+	return h.Algorithm.New().Sum(nil)
+}
+
+// Size returns the length of the hashes produced by h.
+func (h Hasher) Size() int {
+	return h.Algorithm.Size()
+}
+
+func (h Hasher) sum(prefix byte, val []byte) []byte {
+	if h.Algorithm == SHA256 && !h.DomainSeparated {
+		return doHash(val)
+	}
+	d := h.Algorithm.New()
+	if h.DomainSeparated {
+		d.Write([]byte{prefix})
+	}
+	d.Write(val)
+	return d.Sum(nil)
+}
+
+// isInterior reports whether n holds the concatenated
+// hashes of two children, regardless of whether
+// those children are still attached.
+func (h Hasher) isInterior(n *Node) bool {
+	return n != nil && len(n.Val) == 2*h.Size()
+}
+
+// nodeHash returns the hash that represents n in its parent.
+// Unlike [Node.ComputeHash] this also handles interior
+// nodes whose children have been trimmed.
+func (h Hasher) nodeHash(n *Node) []byte {
+	if h.isInterior(n) {
+		return h.Interior(n.Val)
+	}
+	return n.Val
+}
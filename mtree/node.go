@@ -16,6 +16,11 @@ type Node struct {
 	// hashedVal []byte
 	// Depth of the node (how many layers are below it). Used to speed up insertion.
 	depth int
+	// Offset and Length of a leaf's chunk of data in bytes. They are only
+	// set (Length > 0) for leaves of trees whose chunks are not uniformly
+	// sized. See [Tree.LeafSpan].
+	Offset int64
+	Length int64
 }
 
 func NewNode(val []byte, left, right *Node) Node {
@@ -65,11 +70,19 @@ func (n *Node) depthBalance() (int, bool) {
 	return 0, false
 }
 
+// ComputeHash returns the hash of the node
+// using the [Legacy] hasher.
 func (n Node) ComputeHash() []byte {
+	return n.ComputeHashWith(Legacy)
+}
+
+// ComputeHashWith returns the hash of the node
+// using the given hasher.
+func (n Node) ComputeHashWith(h Hasher) []byte {
 	if n.IsLeaf() {
 		return n.Val
 	}
-	return doHash(n.Val)
+	return h.Interior(n.Val)
 }
 
 func (n Node) String() string {
@@ -77,18 +90,18 @@ func (n Node) String() string {
 }
 
 func cat(h1, h2 []byte) []byte {
-	cat := make([]byte, 64)
-	copy(cat[:32], h1)
-	copy(cat[32:], h2)
+	cat := make([]byte, len(h1)+len(h2))
+	copy(cat, h1)
+	copy(cat[len(h1):], h2)
 	return cat
 }
 
 // add inserts a leaf to the current node structure
 // and returns if the insertion requires a new parent node.
-func (n *Node) add(hashVal []byte) (newParent *Node, hasNewParent bool) {
+func (n *Node) add(h Hasher, hashVal []byte) (newParent *Node, hasNewParent bool) {
 	if n.isBalanced() {
 		newParent = &Node{
-			Val:  cat(n.ComputeHash(), hashVal),
+			Val:  cat(n.ComputeHashWith(h), hashVal),
 			Left: n,
 			Right: &Node{
 				Val:   hashVal,
@@ -100,10 +113,10 @@ func (n *Node) add(hashVal []byte) (newParent *Node, hasNewParent bool) {
 		}
 		return newParent, true
 	}
-	if newP, ok := n.Right.add(hashVal); ok {
+	if newP, ok := n.Right.add(h, hashVal); ok {
 		n.Right = newP
 	}
-	n.Val = cat(n.Left.ComputeHash(), n.Right.ComputeHash())
+	n.Val = cat(n.Left.ComputeHashWith(h), n.Right.ComputeHashWith(h))
 	return nil, false
 }
 
@@ -114,7 +127,8 @@ func (n Node) sRec(depth int) string {
 	if n.IsLeaf() {
 		str += "——Node with val [" + base64.StdEncoding.EncodeToString(n.Val[:]) + "]"
 	} else {
-		str += "|-Node with val [" + base64.StdEncoding.EncodeToString(n.Val[:32]) + "|" + base64.StdEncoding.EncodeToString(n.Val[32:]) + "]"
+		half := len(n.Val) / 2
+		str += "|-Node with val [" + base64.StdEncoding.EncodeToString(n.Val[:half]) + "|" + base64.StdEncoding.EncodeToString(n.Val[half:]) + "]"
 	}
 	// if !n.IsLeaf() {
 	// 	str += "|-Node with val [" + base64.StdEncoding.EncodeToString(n.Val[:]) + "]"
@@ -128,17 +142,35 @@ func (n Node) sRec(depth int) string {
 	return str
 }
 
+func (n *Node) clone() *Node {
+	if n == nil {
+		return nil
+	}
+	return &Node{
+		Val:    n.Val,
+		Left:   n.Left.clone(),
+		Right:  n.Right.clone(),
+		depth:  n.depth,
+		Offset: n.Offset,
+		Length: n.Length,
+	}
+}
+
 func (cur *Node) trimLeaves() {
 	if cur.Left != nil {
 		if cur.Left.IsLeaf() {
-			cur.Left = nil
+			if cur.Left.Length == 0 {
+				cur.Left = nil
+			}
 		} else {
 			cur.Left.trimLeaves()
 		}
 	}
 	if cur.Right != nil {
 		if cur.Right.IsLeaf() {
-			cur.Right = nil
+			if cur.Right.Length == 0 {
+				cur.Right = nil
+			}
 		} else {
 			cur.Right.trimLeaves()
 		}
@@ -0,0 +1,132 @@
+package mtree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// ProofStep is a single sibling hash on the
+// path from a leaf up to the root.
+type ProofStep struct {
+	Hash []byte `json:"hash"`
+	// Left is true if the sibling is the left
+	// child of the parent, false if it is the right.
+	Left bool `json:"left"`
+}
+
+// Proof is an audit path for a single leaf.
+// Path is ordered from the leaf up to the root.
+type Proof struct {
+	Index  int         `json:"index"`
+	Leaves int         `json:"leaves"`
+	Path   []ProofStep `json:"path"`
+	// Span is the position of the leaf's chunk, if the tree knows it.
+	// It is not covered by the root hash.
+	Span *Span `json:"span,omitempty"`
+}
+
+// Proof returns the audit path for the leaf at the given index.
+// This works for trees built by [Tree.AddData], by hash.HashArray.BuildTree,
+// and for trees that have had their leaves removed with [Tree.TrimLeaves].
+func (t Tree) Proof(index int) (*Proof, error) {
+	if t.Root == nil {
+		return nil, fmt.Errorf("cannot build proof for empty tree")
+	}
+	cur := t.rootSubtree()
+	if index < 0 || index >= cur.leaves {
+		return nil, fmt.Errorf("leaf index %d out of range, tree has %d leaves", index, cur.leaves)
+	}
+	proof := &Proof{
+		Index:  index,
+		Leaves: cur.leaves,
+	}
+	offset := index
+	for cur.leaves > 1 {
+		left, right := cur.children()
+		if offset < left.leaves {
+			proof.Path = append(proof.Path, ProofStep{Hash: right.hash, Left: false})
+			cur = left
+		} else {
+			proof.Path = append(proof.Path, ProofStep{Hash: left.hash, Left: true})
+			offset -= left.leaves
+			cur = right
+		}
+	}
+	// Path was collected from the root down
+	for i, j := 0, len(proof.Path)-1; i < j; i, j = i+1, j-1 {
+		proof.Path[i], proof.Path[j] = proof.Path[j], proof.Path[i]
+	}
+	if span, err := t.LeafSpan(index); err == nil {
+		proof.Span = &span
+	}
+	return proof, nil
+}
+
+// RootFrom folds the audit path over the given
+// leaf hash and returns the resulting root hash.
+// It returns nil if the path is not the one of the
+// leaf at Index in a tree with Leaves leaves.
+func (p Proof) RootFrom(h Hasher, leafHash []byte) []byte {
+	sides := pathSides(p.Index, p.Leaves)
+	if sides == nil || len(p.Path) != len(sides) {
+		return nil
+	}
+	cur := leafHash
+	for idx, step := range p.Path {
+		// The side of each sibling follows from the index
+		// (RFC 9162 section 2.1.3.2), Left must agree with it
+		if step.Left != sides[idx] {
+			return nil
+		}
+		if step.Left {
+			cur = h.Interior(cat(step.Hash, cur))
+		} else {
+			cur = h.Interior(cat(cur, step.Hash))
+		}
+	}
+	return cur
+}
+
+// pathSides returns whether each sibling on the path of the leaf
+// at index in a tree of n leaves is a left child, ordered from the
+// leaf up like [Proof.Path]. It returns nil if index is out of range.
+func pathSides(index, n int) []bool {
+	if index < 0 || index >= n {
+		return nil
+	}
+	sides := []bool{}
+	for n > 1 {
+		k := splitPoint(n)
+		if index < k {
+			sides = append(sides, false)
+			n = k
+		} else {
+			sides = append(sides, true)
+			index -= k
+			n -= k
+		}
+	}
+	// Collected from the root down
+	slices.Reverse(sides)
+	return sides
+}
+
+// VerifyProof checks that the given chunk of data
+// is included in the tree with the given root hash,
+// using only the audit path in proof.
+// Trees built with a non-default hasher should use [Hasher.VerifyProof].
+func VerifyProof(root, data []byte, proof *Proof) bool {
+	return Legacy.VerifyProof(root, data, proof)
+}
+
+// VerifyProof checks that the given chunk of data
+// is included in the tree with the given root hash,
+// using only the audit path in proof.
+func (h Hasher) VerifyProof(root, data []byte, proof *Proof) bool {
+	if proof == nil {
+		return false
+	}
+	computed := proof.RootFrom(h, h.Leaf(data))
+	return computed != nil && bytes.Equal(computed, root)
+}
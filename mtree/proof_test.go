@@ -0,0 +1,204 @@
+package mtree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+var testHashers = []Hasher{
+	Legacy,
+	DomainSeparated,
+	{Algorithm: BLAKE2b_256, DomainSeparated: true},
+}
+
+// testData returns n distinct chunks of data.
+func testData(n int) [][]byte {
+	chunks := make([][]byte, n)
+	for idx := range chunks {
+		chunks[idx] = []byte(fmt.Sprintf("chunk %d", idx))
+	}
+	return chunks
+}
+
+// buildTree adds every chunk to a new tree with [Tree.AddData].
+func buildTree(h Hasher, chunks [][]byte) *Tree {
+	tree := NewEmpty()
+	tree.Hasher = h
+	for _, chunk := range chunks {
+		tree.AddData(chunk)
+	}
+	return tree
+}
+
+// referenceRoot computes MTH from RFC 6962 section 2.1 directly.
+func referenceRoot(h Hasher, chunks [][]byte) []byte {
+	if len(chunks) == 0 {
+		return h.Empty()
+	}
+	if len(chunks) == 1 {
+		return h.Leaf(chunks[0])
+	}
+	k := splitPoint(len(chunks))
+	return h.Interior(cat(referenceRoot(h, chunks[:k]), referenceRoot(h, chunks[k:])))
+}
+
+func TestRootMatchesReference(t *testing.T) {
+	for _, h := range testHashers {
+		for n := 0; n <= 33; n++ {
+			chunks := testData(n)
+			tree := buildTree(h, chunks)
+			if !bytes.Equal(tree.RootHash(), referenceRoot(h, chunks)) {
+				t.Errorf("%v, %d leaves: root does not match RFC 6962", h, n)
+			}
+			if got := tree.LeafCount(); got != n {
+				t.Errorf("%v: LeafCount() = %d, want %d", h, got, n)
+			}
+		}
+	}
+}
+
+func TestProof(t *testing.T) {
+	for _, h := range testHashers {
+		for n := 1; n <= 33; n++ {
+			chunks := testData(n)
+			tree := buildTree(h, chunks)
+			trimmed := tree.Clone()
+			trimmed.TrimLeaves()
+			root := tree.RootHash()
+			for idx, chunk := range chunks {
+				proof, err := tree.Proof(idx)
+				if err != nil {
+					t.Fatalf("%v, %d leaves: Proof(%d): %v", h, n, idx, err)
+				}
+				if proof.Index != idx || proof.Leaves != n {
+					t.Errorf("Proof(%d) of %d leaves has Index %d, Leaves %d", idx, n, proof.Index, proof.Leaves)
+				}
+				if !h.VerifyProof(root, chunk, proof) {
+					t.Errorf("%v, %d leaves: proof of leaf %d does not verify", h, n, idx)
+				}
+				trimmedProof, err := trimmed.Proof(idx)
+				if err != nil {
+					t.Fatalf("trimmed Proof(%d): %v", idx, err)
+				}
+				if !h.VerifyProof(root, chunk, trimmedProof) {
+					t.Errorf("%v, %d leaves: proof of leaf %d from trimmed tree does not verify", h, n, idx)
+				}
+			}
+		}
+	}
+}
+
+func TestProofRejectsTampering(t *testing.T) {
+	for _, h := range testHashers {
+		chunks := testData(13)
+		tree := buildTree(h, chunks)
+		root := tree.RootHash()
+		for idx, chunk := range chunks {
+			proof, err := tree.Proof(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := chunks[(idx+1)%len(chunks)]
+			if h.VerifyProof(root, other, proof) {
+				t.Errorf("%v: proof of leaf %d verifies the data of another leaf", h, idx)
+			}
+			if h.VerifyProof(root, append([]byte{}, chunk[:len(chunk)-1]...), proof) {
+				t.Errorf("%v: proof of leaf %d verifies truncated data", h, idx)
+			}
+			if h.VerifyProof(h.Leaf(chunk), chunk, proof) {
+				t.Errorf("%v: proof of leaf %d verifies against the wrong root", h, idx)
+			}
+			for step := range proof.Path {
+				flipped := cloneProof(proof)
+				flipped.Path[step].Hash[0] ^= 1
+				if h.VerifyProof(root, chunk, flipped) {
+					t.Errorf("%v: proof of leaf %d verifies with step %d tampered", h, idx, step)
+				}
+				swapped := cloneProof(proof)
+				swapped.Path[step].Left = !swapped.Path[step].Left
+				if h.VerifyProof(root, chunk, swapped) {
+					t.Errorf("%v: proof of leaf %d verifies with step %d on the wrong side", h, idx, step)
+				}
+			}
+			short := cloneProof(proof)
+			short.Path = short.Path[:len(short.Path)-1]
+			if h.VerifyProof(root, chunk, short) {
+				t.Errorf("%v: proof of leaf %d verifies with a step missing", h, idx)
+			}
+			long := cloneProof(proof)
+			long.Path = append(long.Path, ProofStep{Hash: root, Left: true})
+			if h.VerifyProof(root, chunk, long) {
+				t.Errorf("%v: proof of leaf %d verifies with an extra step", h, idx)
+			}
+			outOfRange := cloneProof(proof)
+			outOfRange.Index = outOfRange.Leaves
+			if h.VerifyProof(root, chunk, outOfRange) {
+				t.Errorf("%v: proof with an out of range index verifies", h)
+			}
+			// The index is not covered by the hashes, so it must
+			// decide which side each step is on
+			for other := range chunks {
+				relabelled := cloneProof(proof)
+				relabelled.Index = other
+				if other != idx && h.VerifyProof(root, chunk, relabelled) {
+					t.Errorf("%v: proof of leaf %d verifies as leaf %d", h, idx, other)
+				}
+			}
+		}
+		if h.VerifyProof(root, chunks[0], nil) {
+			t.Errorf("%v: nil proof verifies", h)
+		}
+	}
+}
+
+// TestVerifyProofLegacy checks that the package level
+// VerifyProof keeps verifying proofs of existing trees.
+func TestVerifyProofLegacy(t *testing.T) {
+	chunks := testData(6)
+	tree := buildTree(Legacy, chunks)
+	proof, err := tree.Proof(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyProof(tree.RootHash(), chunks[4], proof) {
+		t.Error("VerifyProof rejects a proof from a legacy tree")
+	}
+	if VerifyProof(buildTree(DomainSeparated, chunks).RootHash(), chunks[4], proof) {
+		t.Error("VerifyProof accepts a domain separated root")
+	}
+}
+
+func TestProofOutOfRange(t *testing.T) {
+	tree := buildTree(DomainSeparated, testData(5))
+	for _, idx := range []int{-1, 5, 100} {
+		if _, err := tree.Proof(idx); err == nil {
+			t.Errorf("Proof(%d) of 5 leaves succeeded", idx)
+		}
+	}
+	if _, err := NewEmpty().Proof(0); err == nil {
+		t.Error("Proof(0) of an empty tree succeeded")
+	}
+}
+
+func TestProofSpan(t *testing.T) {
+	tree := buildTree(DomainSeparated, testData(3))
+	tree.ChunkSize, tree.Length = 1024, 2500
+	proof, err := tree.Proof(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Span{Offset: 2048, Length: 452}
+	if proof.Span == nil || *proof.Span != want {
+		t.Errorf("Proof(2).Span = %v, want %v", proof.Span, want)
+	}
+}
+
+func cloneProof(p *Proof) *Proof {
+	clone := *p
+	clone.Path = make([]ProofStep, len(p.Path))
+	for idx, step := range p.Path {
+		clone.Path[idx] = ProofStep{Hash: append([]byte{}, step.Hash...), Left: step.Left}
+	}
+	return &clone
+}
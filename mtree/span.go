@@ -0,0 +1,178 @@
+package mtree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Span is the position of a leaf's chunk of data in bytes.
+type Span struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// End returns the offset just past the end of the chunk.
+func (s Span) End() int64 {
+	return s.Offset + s.Length
+}
+
+// leafNode returns the node of the leaf at the given index,
+// which is nil if it was removed by [Tree.TrimLeaves].
+func (t Tree) leafNode(index int) *Node {
+	cur := t.rootSubtree()
+	for cur.leaves > 1 && cur.node != nil {
+		left, right := cur.children()
+		if index < left.leaves {
+			cur = left
+		} else {
+			index -= left.leaves
+			cur = right
+		}
+	}
+	return cur.node
+}
+
+// hasSpans reports whether the leaves of the tree carry their own spans,
+// as they do for trees whose chunks are not uniformly sized.
+func (t Tree) hasSpans() bool {
+	if t.Root == nil {
+		return false
+	}
+	leaf := t.leafNode(0)
+	return leaf != nil && leaf.Length > 0
+}
+
+// LeafSpan returns the position of the chunk of the leaf at the given
+// index. It is read from the leaf if it carries a span, and otherwise
+// derived from the tree's ChunkSize, where the final chunk ends at Length.
+func (t Tree) LeafSpan(index int) (Span, error) {
+	leaves := t.LeafCount()
+	if index < 0 || index >= leaves {
+		return Span{}, fmt.Errorf("leaf index %d out of range, tree has %d leaves", index, leaves)
+	}
+	if leaf := t.leafNode(index); leaf != nil && leaf.Length > 0 {
+		return Span{Offset: leaf.Offset, Length: leaf.Length}, nil
+	}
+	if t.ChunkSize <= 0 {
+		return Span{}, fmt.Errorf("tree has no chunk size or leaf spans")
+	}
+	span := Span{Offset: int64(index) * int64(t.ChunkSize), Length: int64(t.ChunkSize)}
+	// The final chunk may be short. If the length is unknown it is assumed to be full.
+	if t.Length > 0 && span.End() > t.Length {
+		span.Length = t.Length - span.Offset
+	}
+	return span, nil
+}
+
+// LeafSpans returns the span of every leaf in order, or nil
+// if the leaves do not carry spans.
+func (t Tree) LeafSpans() []Span {
+	if !t.hasSpans() {
+		return nil
+	}
+	spans := make([]Span, t.LeafCount())
+	for idx := range spans {
+		leaf := t.leafNode(idx)
+		spans[idx] = Span{Offset: leaf.Offset, Length: leaf.Length}
+	}
+	return spans
+}
+
+// ByteLength returns the total length in bytes of the data the tree
+// was built from. For trees without leaf spans this is Length.
+func (t Tree) ByteLength() int64 {
+	if !t.hasSpans() {
+		return t.Length
+	}
+	last := t.leafNode(t.LeafCount() - 1)
+	return last.Offset + last.Length
+}
+
+// ByteRange returns the half-open range of bytes covered by the
+// given leaves. Unlike [LeafRange.ByteRange] it also works for trees
+// whose chunks are not uniformly sized.
+func (t Tree) ByteRange(r LeafRange) (start, end int64, err error) {
+	if r.Len() <= 0 {
+		return 0, 0, fmt.Errorf("empty leaf range %d-%d", r.Start, r.End)
+	}
+	first, err := t.LeafSpan(r.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	last, err := t.LeafSpan(r.End - 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return first.Offset, last.End(), nil
+}
+
+// LeavesInRange returns the range of leaves whose chunks
+// overlap the half-open range of bytes [start, end).
+func (t Tree) LeavesInRange(start, end int64) (LeafRange, error) {
+	leaves := t.LeafCount()
+	if start < 0 || start >= end || end > t.ByteLength() {
+		return LeafRange{}, fmt.Errorf("byte range %d-%d out of bounds (length %d)", start, end, t.ByteLength())
+	}
+	if spans := t.LeafSpans(); spans != nil {
+		first := sort.Search(leaves, func(i int) bool { return spans[i].End() > start })
+		last := sort.Search(leaves, func(i int) bool { return spans[i].Offset >= end })
+		return LeafRange{Start: first, End: last}, nil
+	}
+	if t.ChunkSize <= 0 {
+		return LeafRange{}, fmt.Errorf("tree has no chunk size or leaf spans")
+	}
+	chunkSize := int64(t.ChunkSize)
+	return LeafRange{
+		Start: int(start / chunkSize),
+		End:   int((end + chunkSize - 1) / chunkSize),
+	}, nil
+}
+
+// VerifyRange checks data, the bytes of the given leaves, against a
+// trusted root using the proofs of t. The tree itself does not need
+// to be trusted.
+func (t Tree) VerifyRange(root []byte, r LeafRange, data []byte) error {
+	start, end, err := t.ByteRange(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != end-start {
+		return fmt.Errorf("leaves %d-%d hold %d bytes, got %d", r.Start, r.End-1, end-start, len(data))
+	}
+	for idx := r.Start; idx < r.End; idx++ {
+		span, err := t.LeafSpan(idx)
+		if err != nil {
+			return err
+		}
+		chunk := data[span.Offset-start : span.End()-start]
+		proof, err := t.Proof(idx)
+		if err != nil {
+			return err
+		}
+		if !t.Hasher.VerifyProof(root, chunk, proof) {
+			return fmt.Errorf("chunk %d failed verification", idx)
+		}
+	}
+	return nil
+}
+
+// setSpans sets the span of every leaf from their lengths,
+// which are contiguous starting at offset 0.
+func (t Tree) setSpans(lengths []int64) error {
+	if len(lengths) != t.LeafCount() {
+		return fmt.Errorf("mtree: %d spans for %d leaves", len(lengths), t.LeafCount())
+	}
+	var offset int64
+	for idx, length := range lengths {
+		leaf := t.leafNode(idx)
+		if leaf == nil {
+			return fmt.Errorf("mtree: leaf %d was trimmed and cannot hold a span", idx)
+		}
+		if length <= 0 {
+			return fmt.Errorf("mtree: leaf %d has invalid length %d", idx, length)
+		}
+		leaf.Offset, leaf.Length = offset, length
+		offset += length
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package mtree
+
+import (
+	"bytes"
+	"testing"
+)
+
+// spanTree returns data split into chunks of the given
+// lengths and the tree of those chunks with their spans.
+func spanTree(t *testing.T, lengths []int64) ([]byte, *Tree) {
+	t.Helper()
+	var data []byte
+	hashes := make([][]byte, len(lengths))
+	for idx, length := range lengths {
+		chunk := bytes.Repeat([]byte{byte(idx)}, int(length))
+		hashes[idx] = DomainSeparated.Leaf(chunk)
+		data = append(data, chunk...)
+	}
+	tree, err := FromLeafSpans(hashes, lengths, DomainSeparated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, tree
+}
+
+func TestLeavesInRange(t *testing.T) {
+	_, spans := spanTree(t, []int64{3, 10, 1, 7, 12})
+	fixed := buildTree(DomainSeparated, testData(5))
+	fixed.ChunkSize, fixed.Length = 8, 37
+	tests := []struct {
+		tree       *Tree
+		start, end int64
+		want       LeafRange
+	}{
+		{spans, 0, 1, LeafRange{0, 1}},
+		{spans, 2, 4, LeafRange{0, 2}},
+		{spans, 13, 14, LeafRange{2, 3}},
+		{spans, 12, 33, LeafRange{1, 5}},
+		{fixed, 0, 8, LeafRange{0, 1}},
+		{fixed, 7, 9, LeafRange{0, 2}},
+		{fixed, 32, 37, LeafRange{4, 5}},
+	}
+	for _, test := range tests {
+		got, err := test.tree.LeavesInRange(test.start, test.end)
+		if err != nil || got != test.want {
+			t.Errorf("LeavesInRange(%d, %d) = %v, %v, want %v", test.start, test.end, got, err, test.want)
+		}
+	}
+	for _, tree := range []*Tree{spans, fixed} {
+		if _, err := tree.LeavesInRange(0, tree.ByteLength()+1); err == nil {
+			t.Error("LeavesInRange accepted a range past the end")
+		}
+	}
+}
+
+func TestVerifyRangeSpans(t *testing.T) {
+	data, tree := spanTree(t, []int64{3, 10, 1, 7, 12})
+	root := tree.RootHash()
+	// Leaves that carry spans are kept when trimming
+	trimmed := tree.Clone()
+	trimmed.TrimLeaves()
+	for _, tree := range []*Tree{tree, trimmed} {
+		r := LeafRange{Start: 1, End: 4}
+		start, end, err := tree.ByteRange(r)
+		if err != nil || start != 3 || end != 21 {
+			t.Fatalf("ByteRange(%v) = %d, %d, %v", r, start, end, err)
+		}
+		if err := tree.VerifyRange(root, r, data[start:end]); err != nil {
+			t.Errorf("VerifyRange: %v", err)
+		}
+		corrupt := bytes.Clone(data[start:end])
+		corrupt[len(corrupt)-1] ^= 1
+		if err := tree.VerifyRange(root, r, corrupt); err == nil {
+			t.Error("VerifyRange accepted corrupted data")
+		}
+		if err := tree.VerifyRange(root, r, data[start:end-1]); err == nil {
+			t.Error("VerifyRange accepted data of the wrong length")
+		}
+	}
+	if _, err := FromLeafSpans(tree.LeafHashes(), []int64{3, 10, 0, 7, 12}, DomainSeparated); err == nil {
+		t.Error("FromLeafSpans accepted an empty chunk")
+	}
+}
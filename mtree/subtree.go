@@ -0,0 +1,58 @@
+package mtree
+
+// subtree is a view of a node along with its hash
+// and the number of leaves below it. Trees that have
+// had [Tree.TrimLeaves] called on them only know their
+// leaves through the Val of the parent, so node may be
+// nil for a leaf.
+type subtree struct {
+	node   *Node
+	hash   []byte
+	leaves int
+}
+
+// leafCount returns the number of leaves below n.
+// Both AddData and BuildTree produce trees whose left
+// subtree is always perfect, so only the left spine of
+// each left child and the right spine need to be walked.
+func (h Hasher) leafCount(n *Node) int {
+	count := 0
+	for h.isInterior(n) {
+		depth := 0
+		for l := n.Left; h.isInterior(l); l = l.Left {
+			depth++
+		}
+		count += 1 << depth
+		n = n.Right
+	}
+	return count + 1
+}
+
+// splitPoint returns the number of leaves in the left
+// subtree of a node with n leaves, which is the largest
+// power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func (t Tree) rootSubtree() subtree {
+	return subtree{
+		node:   t.Root,
+		hash:   t.Hasher.nodeHash(t.Root),
+		leaves: t.Hasher.leafCount(t.Root),
+	}
+}
+
+// children returns the left and right subtrees of s.
+// It must only be called when s has more than one leaf.
+func (s subtree) children() (left, right subtree) {
+	half := len(s.node.Val) / 2
+	k := splitPoint(s.leaves)
+	left = subtree{node: s.node.Left, hash: s.node.Val[:half], leaves: k}
+	right = subtree{node: s.node.Right, hash: s.node.Val[half:], leaves: s.leaves - k}
+	return left, right
+}
@@ -14,6 +14,16 @@ func doHash(val []byte) []byte {
 // A representation of a Merkle Tree.
 type Tree struct {
 	Root *Node
+	// Hasher used for leaves and interior nodes.
+	// The zero value is the [Legacy] hasher.
+	Hasher Hasher
+	// ChunkSize and Length are the size of each leaf's chunk and the
+	// total length of the data in bytes, and are recorded by
+	// [Tree.Encode]. They are zero if unknown. Trees with chunks of
+	// varying size record a [Span] in each leaf instead, and have
+	// a ChunkSize of zero.
+	ChunkSize int
+	Length    int64
 }
 
 // Creates a new empty Merkle tree.
@@ -29,24 +39,26 @@ func New(root *Node) *Tree {
 }
 
 // Returns the root hash of the merkle tree.
-// If the root is nil, it will return an empty byte array.
+// A tree with no leaves, such as the tree of an empty
+// file, has the hash of no data as its root.
 func (b Tree) RootHash() []byte {
 	if b.Root != nil {
-		return b.Root.ComputeHash()
+		// The root of a trimmed tree may have no children left
+		return b.Hasher.nodeHash(b.Root)
 	}
-	return []byte{}
+	return b.Hasher.Empty()
 }
 
 // AddData inserts a new leaf node into the merkle tree
 // with the hash of the given piece of data.
 func (bt *Tree) AddData(val []byte) {
-	hashVal := doHash(val)
+	hashVal := bt.Hasher.Leaf(val)
 	if bt.Root == nil {
 		bt.Root = &Node{
 			Val:   hashVal,
 			depth: 1,
 		}
-	} else if newP, ok := bt.Root.add(hashVal); ok {
+	} else if newP, ok := bt.Root.add(bt.Hasher, hashVal); ok {
 		bt.Root = newP
 	}
 }
@@ -60,20 +72,24 @@ func (bt Tree) String() string {
 	return "Empty Tree"
 }
 
-var (
-	chunkSize = 64
-	nilMarker = make([]byte, 64)
-)
-
 // FromArray converts an array of bytes produced by
 // [ToArray] back into a Merkle tree.
 func FromArray(arr []byte) (*Tree, error) {
+	return FromArrayWith(arr, Legacy)
+}
+
+// FromArrayWith converts an array of bytes produced by
+// [ToArray] back into a Merkle tree built with the given hasher.
+func FromArrayWith(arr []byte, h Hasher) (*Tree, error) {
+	chunkSize := 2 * h.Size()
+	nilMarker := make([]byte, chunkSize)
 	if len(arr)%chunkSize != 0 || len(arr) == 0 {
-		return nil, fmt.Errorf("Invalid array length, must be a multiple of 64 bytes, len(arr)=%d", len(arr)) // Invalid data length, must be a multiple of 64 bytes
+		return nil, fmt.Errorf("Invalid array length, must be a multiple of %d bytes, len(arr)=%d", chunkSize, len(arr))
 	}
 	newTree := New(&Node{
 		Val: arr[:chunkSize],
 	})
+	newTree.Hasher = h
 
 	queue := []*Node{newTree.Root}
 
@@ -106,7 +122,9 @@ func FromArray(arr []byte) (*Tree, error) {
 // ToArray serializes a merkle tree
 // into an array-of-bytes representation.
 // Use [FromArray] to convert back into a tree.
+// See [Tree.Encode] for a self-describing format.
 func (t Tree) ToArray() []byte {
+	nilMarker := make([]byte, 2*t.Hasher.Size())
 	queue := []*Node{t.Root}
 	arr := []byte{}
 
@@ -125,11 +143,33 @@ func (t Tree) ToArray() []byte {
 	return arr
 }
 
+// Clone returns a deep copy of the tree, so it
+// can be modified (for example by [Tree.TrimLeaves])
+// without affecting the original. Node values are shared.
+func (t Tree) Clone() *Tree {
+	return &Tree{
+		Root:      t.Root.clone(),
+		Hasher:    t.Hasher,
+		ChunkSize: t.ChunkSize,
+		Length:    t.Length,
+	}
+}
+
 // TrimLeaves removes the bottom-most layer of the merkle tree.
 // This is typically used prior to serialization, since the parents
-// of the leaves contain the same information.
+// of the leaves contain the same information. Leaves that carry a
+// [Span] are kept, as their position is not stored anywhere else.
 func (bt *Tree) TrimLeaves() {
 	if bt.Root != nil {
 		bt.Root.trimLeaves()
 	}
 }
+
+// LeafCount returns the number of leaves in the tree.
+// This also works for trees that have had [Tree.TrimLeaves] called on them.
+func (t Tree) LeafCount() int {
+	if t.Root == nil {
+		return 0
+	}
+	return t.Hasher.leafCount(t.Root)
+}
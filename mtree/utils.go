@@ -11,6 +11,7 @@ func CompareTrees(t1, t2 *Tree) {
 	fmt.Println("Comparison of trees:")
 	fmt.Println(cmpNodes(t1.Root, t2.Root, 0))
 	fmt.Printf("Root hash matches: %t\n", slices.Equal(t1.Root.Val, t2.Root.Val))
+	fmt.Printf("Differing leaves: %v\n", Diff(t1, t2))
 }
 
 func cmpNodes(n1, n2 *Node, depth int) string {
@@ -0,0 +1,28 @@
+package mtree
+
+// Walk visits every node of the tree in pre-order (a node, then its
+// left subtree, then its right subtree), calling fn with the range of
+// leaves below the node. For interior nodes children holds the
+// concatenated hashes of its two children, for leaves it is nil.
+// This also works for trees that have had [Tree.TrimLeaves] called on
+// them. Walk stops at the first error returned by fn.
+func (t Tree) Walk(fn func(leaves LeafRange, children []byte) error) error {
+	if t.Root == nil {
+		return nil
+	}
+	return t.rootSubtree().walk(0, fn)
+}
+
+func (s subtree) walk(lo int, fn func(leaves LeafRange, children []byte) error) error {
+	if s.leaves == 1 {
+		return fn(LeafRange{Start: lo, End: lo + 1}, nil)
+	}
+	if err := fn(LeafRange{Start: lo, End: lo + s.leaves}, s.node.Val); err != nil {
+		return err
+	}
+	left, right := s.children()
+	if err := left.walk(lo, fn); err != nil {
+		return err
+	}
+	return right.walk(lo+left.leaves, fn)
+}
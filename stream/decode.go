@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Decoder reads an encoded file, verifying each chunk against the root
+// hash before returning it. Data is only ever returned once it has been
+// verified, so a reader sees an error instead of corrupt bytes.
+type Decoder struct {
+	// Source of the length and interior nodes
+	tree io.Reader
+	// Source of the chunks, which is tree for the combined encoding
+	data      io.Reader
+	root      []byte
+	hasher    mtree.Hasher
+	chunkSize int
+
+	length int64
+	// Nodes that still have to be read, the next one is last
+	pending []node
+	started bool
+	// Verified bytes of the current chunk that have not been read yet
+	chunk []byte
+	buf   []byte
+	err   error
+}
+
+// node is a subtree that has been verified by its parent,
+// along with the leaves it covers.
+type node struct {
+	hash   []byte
+	leaves mtree.LeafRange
+}
+
+// NewDecoder returns a Decoder reading the combined encoding from r,
+// verified against root using the given chunk size and hasher.
+// The hasher must be domain separated, see [NewOutboardDecoder].
+func NewDecoder(r io.Reader, root []byte, chunkSize int, hasher mtree.Hasher) (*Decoder, error) {
+	return NewOutboardDecoder(r, r, root, chunkSize, hasher)
+}
+
+// NewOutboardDecoder returns a Decoder reading the original file from
+// data and its outboard encoding from outboard, verified against root
+// using the given chunk size and hasher.
+//
+// The length at the start of the encoding is not covered by the root,
+// so it decides which nodes are read as leaves. Unless the hasher is
+// domain separated, an encoding with a shorter length could pass off
+// the children of an interior node as a leaf and decode to a forged
+// file, so other hashers are rejected.
+func NewOutboardDecoder(data, outboard io.Reader, root []byte, chunkSize int, hasher mtree.Hasher) (*Decoder, error) {
+	if !hasher.DomainSeparated {
+		return nil, errors.New("stream: decoding requires a domain separated hasher")
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("stream: invalid chunk size %d", chunkSize)
+	}
+	return &Decoder{
+		tree:      outboard,
+		data:      data,
+		root:      root,
+		hasher:    hasher,
+		chunkSize: chunkSize,
+		buf:       make([]byte, chunkSize),
+	}, nil
+}
+
+// Length returns the length of the decoded file, reading it from
+// the start of the encoding if needed. The length is only verified
+// as the chunks are read.
+func (d *Decoder) Length() (int64, error) {
+	if err := d.start(); err != nil {
+		return 0, err
+	}
+	return d.length, nil
+}
+
+// Read reads verified bytes of the file into p. It returns
+// ErrVerification if the encoding does not match the root hash.
+func (d *Decoder) Read(p []byte) (int, error) {
+	if err := d.start(); err != nil {
+		return 0, err
+	}
+	for len(d.chunk) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if len(d.pending) == 0 {
+			d.err = io.EOF
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.chunk)
+	d.chunk = d.chunk[n:]
+	return n, nil
+}
+
+func (d *Decoder) start() error {
+	if d.started {
+		return d.err
+	}
+	d.started = true
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(d.tree, header); err != nil {
+		d.err = unexpectedEOF(err)
+		return d.err
+	}
+	length := binary.BigEndian.Uint64(header)
+	if length > math.MaxInt64-uint64(d.chunkSize) {
+		d.err = ErrVerification
+		return d.err
+	}
+	d.length = int64(length)
+	leaves := leafCount(d.chunkSize, d.length)
+	if leaves == 0 {
+		if !bytes.Equal(d.root, d.hasher.Empty()) {
+			d.err = ErrVerification
+		}
+		return d.err
+	}
+	d.pending = append(d.pending, node{hash: d.root, leaves: mtree.LeafRange{Start: 0, End: leaves}})
+	return nil
+}
+
+// next reads and verifies the next node in pre-order. Interior nodes
+// add their children to pending, and leaves set the current chunk.
+func (d *Decoder) next() error {
+	n := d.pending[len(d.pending)-1]
+	d.pending = d.pending[:len(d.pending)-1]
+	if n.leaves.Len() > 1 {
+		children := make([]byte, 2*d.hasher.Size())
+		if _, err := io.ReadFull(d.tree, children); err != nil {
+			return unexpectedEOF(err)
+		}
+		if !bytes.Equal(d.hasher.Interior(children), n.hash) {
+			return ErrVerification
+		}
+		half := len(children) / 2
+		left, right := n.leaves.Split()
+		// The left child is read first, so it goes on top
+		d.pending = append(d.pending,
+			node{hash: children[half:], leaves: right},
+			node{hash: children[:half], leaves: left},
+		)
+		return nil
+	}
+	start, end := n.leaves.ByteRange(d.chunkSize, d.length)
+	chunk := d.buf[:end-start]
+	if _, err := io.ReadFull(d.data, chunk); err != nil {
+		return unexpectedEOF(err)
+	}
+	if !bytes.Equal(d.hasher.Leaf(chunk), n.hash) {
+		return ErrVerification
+	}
+	d.chunk = chunk
+	return nil
+}
+
+// unexpectedEOF reports a truncated encoding as io.ErrUnexpectedEOF,
+// since the length says more data should follow.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -1,5 +1,102 @@
+// Package stream implements a verified streaming encoding of a file,
+// in the style of Bao. The tree's interior nodes are interleaved with
+// the file's chunks in pre-order, so a receiver that only knows the
+// root hash can verify every chunk as soon as it arrives, without
+// first downloading the whole tree or the whole file.
+//
+// The combined encoding is an 8 byte big-endian content length
+// followed by the nodes of the tree in pre-order. An interior node is
+// written as the concatenated hashes of its two children, and a leaf
+// as the bytes of its chunk. The outboard encoding has the same layout
+// without the chunks, so it can be stored alongside the original file.
+//
+// The chunk size and hasher are not part of the encoding, and must be
+// agreed upon in the same way as the root hash. Decoding requires a
+// domain separated hasher, as the length is not covered by the root.
 package stream
 
-import "io"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 
-func streamBytesWithHash(reader io.Reader)
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// headerSize is the length of the content length prefix
+const headerSize = 8
+
+// ErrVerification is returned when the encoded data
+// does not match the expected root hash.
+var ErrVerification = errors.New("stream: data does not match the root hash")
+
+// Encode writes the combined encoding of a file to w, where tree is the
+// file's tree and data holds the tree's Length bytes, split into chunks
+// of its ChunkSize.
+func Encode(w io.Writer, tree *mtree.Tree, data io.ReaderAt) error {
+	return encode(w, tree, data)
+}
+
+// EncodeOutboard writes the outboard encoding of a file with the given
+// tree to w. It only holds the tree, the chunks are read from the
+// original file when decoding.
+func EncodeOutboard(w io.Writer, tree *mtree.Tree) error {
+	return encode(w, tree, nil)
+}
+
+// EncodedSize returns the length of the combined encoding of
+// a file with the given number of leaves, hash size and length.
+func EncodedSize(leaves, hashSize int, length int64) int64 {
+	return OutboardSize(leaves, hashSize) + length
+}
+
+// OutboardSize returns the length of the outboard encoding
+// of a file with the given number of leaves and hash size.
+func OutboardSize(leaves, hashSize int) int64 {
+	// A tree with n leaves has n-1 interior nodes
+	return headerSize + int64(max(leaves-1, 0))*int64(2*hashSize)
+}
+
+// encode writes the encoding of tree, interleaving chunks
+// from data if it is not nil.
+func encode(w io.Writer, tree *mtree.Tree, data io.ReaderAt) error {
+	chunkSize, length := tree.ChunkSize, tree.Length
+	if chunkSize <= 0 {
+		return fmt.Errorf("stream: invalid chunk size %d", chunkSize)
+	}
+	if tree.LeafCount() != leafCount(chunkSize, length) {
+		return errors.New("stream: tree does not match the length of the file")
+	}
+	if _, err := w.Write(binary.BigEndian.AppendUint64(nil, uint64(length))); err != nil {
+		return err
+	}
+	var chunk []byte
+	if data != nil {
+		chunk = make([]byte, chunkSize)
+	}
+	return tree.Walk(func(leaves mtree.LeafRange, children []byte) error {
+		if children != nil {
+			_, err := w.Write(children)
+			return err
+		}
+		if data == nil {
+			return nil
+		}
+		start, end := leaves.ByteRange(chunkSize, length)
+		n, err := data.ReadAt(chunk[:end-start], start)
+		if n < int(end-start) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		_, err = w.Write(chunk[:n])
+		return err
+	})
+}
+
+// leafCount returns the number of chunks in a file of the given length.
+func leafCount(chunkSize int, length int64) int {
+	return int((length + int64(chunkSize) - 1) / int64(chunkSize))
+}
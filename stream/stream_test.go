@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+const testChunkSize = 16
+
+// testFile returns size bytes of data and their tree.
+func testFile(h mtree.Hasher, size int) ([]byte, *mtree.Tree) {
+	data := merkletest.Data(size)
+	tree := merkletest.Tree(h, data, testChunkSize)
+	tree.ChunkSize, tree.Length = testChunkSize, int64(size)
+	return data, tree
+}
+
+func encodeFile(t *testing.T, tree *mtree.Tree, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, tree, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	h := mtree.DomainSeparated
+	for _, size := range merkletest.Sizes(testChunkSize) {
+		data, tree := testFile(h, size)
+		root := tree.RootHash()
+		encoded := encodeFile(t, tree, data)
+		if want := EncodedSize(tree.LeafCount(), h.Size(), int64(size)); int64(len(encoded)) != want {
+			t.Errorf("%d bytes: encoding is %d bytes, EncodedSize is %d", size, len(encoded), want)
+		}
+		dec, err := NewDecoder(bytes.NewReader(encoded), root, testChunkSize, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length, err := dec.Length(); err != nil || length != int64(size) {
+			t.Errorf("%d bytes: Length() = %d, %v", size, length, err)
+		}
+		decoded, err := io.ReadAll(dec)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%d bytes: decoding failed: %v", size, err)
+		}
+
+		var outboard bytes.Buffer
+		if err := EncodeOutboard(&outboard, tree); err != nil {
+			t.Fatal(err)
+		}
+		if want := OutboardSize(tree.LeafCount(), h.Size()); int64(outboard.Len()) != want {
+			t.Errorf("%d bytes: outboard is %d bytes, OutboardSize is %d", size, outboard.Len(), want)
+		}
+		dec, err = NewOutboardDecoder(bytes.NewReader(data), &outboard, root, testChunkSize, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err = io.ReadAll(dec)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%d bytes: outboard decoding failed: %v", size, err)
+		}
+	}
+}
+
+// TestDecodeRejectsCorruption checks that corrupting or truncating
+// an encoding fails, and that no unverified bytes are returned first.
+func TestDecodeRejectsCorruption(t *testing.T) {
+	h := mtree.DomainSeparated
+	data, tree := testFile(h, 5*testChunkSize+3)
+	encoded := encodeFile(t, tree, data)
+	check := func(name string, corrupt []byte) {
+		dec, err := NewDecoder(bytes.NewReader(corrupt), tree.RootHash(), testChunkSize, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := io.ReadAll(dec)
+		if err == nil {
+			t.Errorf("%s: decoding succeeded", name)
+		}
+		if !bytes.HasPrefix(data, decoded) {
+			t.Errorf("%s: returned bytes that do not match the file", name)
+		}
+	}
+	for idx := range encoded {
+		corrupt := bytes.Clone(encoded)
+		corrupt[idx] ^= 0x01
+		check(fmt.Sprintf("byte %d corrupted", idx), corrupt)
+	}
+	for end := range len(encoded) {
+		check(fmt.Sprintf("truncated to %d bytes", end), encoded[:end])
+	}
+}
+
+func TestDecodeRejectsWrongRoot(t *testing.T) {
+	h := mtree.DomainSeparated
+	for _, size := range merkletest.Sizes(testChunkSize) {
+		data, tree := testFile(h, size)
+		encoded := encodeFile(t, tree, data)
+		_, other := testFile(h, size+1)
+		dec, err := NewDecoder(bytes.NewReader(encoded), other.RootHash(), testChunkSize, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(dec); !errors.Is(err, ErrVerification) {
+			t.Errorf("%d bytes: decoding with the wrong root returned %v", size, err)
+		}
+	}
+}
+
+// TestDecodeRejectsForgedLength passes off the children of the root
+// as a 64 byte file, which only domain separation prevents.
+func TestDecodeRejectsForgedLength(t *testing.T) {
+	h := mtree.DomainSeparated
+	_, tree := testFile(h, 5*testChunkSize)
+	forged := binary.BigEndian.AppendUint64(nil, uint64(2*h.Size()))
+	forged = append(forged, tree.Root.Val...)
+	dec, err := NewDecoder(bytes.NewReader(forged), tree.RootHash(), 2*h.Size(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(dec); !errors.Is(err, ErrVerification) {
+		t.Errorf("forged encoding returned %v", err)
+	}
+}
+
+func TestNewDecoderRejectsInvalidParameters(t *testing.T) {
+	if _, err := NewDecoder(nil, nil, testChunkSize, mtree.Legacy); err == nil {
+		t.Error("NewDecoder accepted a hasher without domain separation")
+	}
+	if _, err := NewOutboardDecoder(nil, nil, nil, testChunkSize, mtree.Legacy); err == nil {
+		t.Error("NewOutboardDecoder accepted a hasher without domain separation")
+	}
+	for _, chunkSize := range []int{0, -1} {
+		if _, err := NewDecoder(nil, nil, chunkSize, mtree.DomainSeparated); err == nil {
+			t.Errorf("NewDecoder accepted chunk size %d", chunkSize)
+		}
+	}
+}
+
+func TestEncodeRejectsMismatchedTree(t *testing.T) {
+	data, tree := testFile(mtree.DomainSeparated, 3*testChunkSize)
+	tree.Length += testChunkSize
+	if err := Encode(io.Discard, tree, bytes.NewReader(data)); err == nil {
+		t.Error("Encode accepted a tree with the wrong length")
+	}
+	tree.ChunkSize = 0
+	if err := EncodeOutboard(io.Discard, tree); err == nil {
+		t.Error("EncodeOutboard accepted a tree without a chunk size")
+	}
+	_, tree = testFile(mtree.DomainSeparated, 3*testChunkSize)
+	if err := Encode(io.Discard, tree, bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("Encode accepted data shorter than the tree")
+	}
+}
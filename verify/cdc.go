@@ -0,0 +1,87 @@
+package verify
+
+import (
+	"io"
+	"os"
+
+	"github.com/Solidsilver/merkle/hash"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Chunk is a leaf of a content-defined tree. Unlike fixed size
+// chunks, the position of a chunk cannot be derived from its index,
+// so it is recorded along with the chunk's leaf hash.
+type Chunk struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Hash   []byte `json:"hash"`
+}
+
+// HashReaderCDC hashes r split into content-defined chunks (see
+// [hash.Chunker]) instead of fixed size ones, so inserting or removing
+// bytes only changes the leaves around the change. It returns the tree,
+// whose leaves carry their [mtree.Span], along with the position of
+// every leaf. Each chunk is hashed as is, without padding.
+func HashReaderCDC(r io.Reader, minSize, avgSize, maxSize int, opts ...Option) (*mtree.Tree, []Chunk, error) {
+	o := newOptions(opts)
+	chunker, err := hash.NewChunker(r, minSize, avgSize, maxSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chunks []Chunk
+	var offset int64
+	for {
+		data, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		chunks = append(chunks, Chunk{
+			Offset: offset,
+			Length: len(data),
+			Hash:   o.hasher.Leaf(data),
+		})
+		offset += int64(len(data))
+	}
+	hashes := make([][]byte, len(chunks))
+	lengths := make([]int64, len(chunks))
+	for idx, chunk := range chunks {
+		hashes[idx] = chunk.Hash
+		lengths[idx] = int64(chunk.Length)
+	}
+	tree, err := mtree.FromLeafSpans(hashes, lengths, o.hasher)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tree, chunks, nil
+}
+
+// HashFileCDC hashes a file with content-defined chunking,
+// see [HashReaderCDC].
+func HashFileCDC(path string, minSize, avgSize, maxSize int, opts ...Option) (*mtree.Tree, []Chunk, error) {
+	openFile, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer openFile.Close()
+	return HashReaderCDC(openFile, minSize, avgSize, maxSize, opts...)
+}
+
+// MissingChunks returns the chunks of want whose contents
+// are not already among have, for example to find what
+// has to be fetched to update a local copy of a file.
+func MissingChunks(have, want []Chunk) []Chunk {
+	known := make(map[string]struct{}, len(have))
+	for _, chunk := range have {
+		known[string(chunk.Hash)] = struct{}{}
+	}
+	var missing []Chunk
+	for _, chunk := range want {
+		if _, ok := known[string(chunk.Hash)]; !ok {
+			missing = append(missing, chunk)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,67 @@
+package verify
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+func TestHashReaderCDC(t *testing.T) {
+	h := mtree.DomainSeparated
+	data := merkletest.Data(100_000)
+	tree, chunks, err := HashReaderCDC(bytes.NewReader(data), 64, 256, 1024, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.LeafCount() != len(chunks) {
+		t.Fatalf("tree has %d leaves for %d chunks", tree.LeafCount(), len(chunks))
+	}
+	var offset int64
+	for idx, chunk := range chunks {
+		if chunk.Offset != offset {
+			t.Fatalf("chunk %d starts at %d, want %d", idx, chunk.Offset, offset)
+		}
+		offset += int64(chunk.Length)
+		if !bytes.Equal(chunk.Hash, h.Leaf(data[chunk.Offset:offset])) {
+			t.Errorf("hash of chunk %d does not match its data", idx)
+		}
+		proof, err := tree.Proof(idx)
+		if err != nil || !h.VerifyProof(tree.RootHash(), data[chunk.Offset:offset], proof) {
+			t.Errorf("chunk %d is not leaf %d of the tree: %v", idx, idx, err)
+		}
+		if want := (mtree.Span{Offset: chunk.Offset, Length: int64(chunk.Length)}); proof.Span == nil || *proof.Span != want {
+			t.Errorf("leaf %d has span %v, want %v", idx, proof.Span, want)
+		}
+	}
+	if offset != int64(len(data)) {
+		t.Errorf("chunks cover %d of %d bytes", offset, len(data))
+	}
+}
+
+func TestMissingChunks(t *testing.T) {
+	data := merkletest.Data(100_000)
+	edited := append(bytes.Clone(data[:50_000]), []byte("inserted bytes")...)
+	edited = append(edited, data[50_000:]...)
+	_, have, err := HashReaderCDC(bytes.NewReader(data), 64, 256, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want, err := HashReaderCDC(bytes.NewReader(edited), 64, 256, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := MissingChunks(have, have); len(missing) != 0 {
+		t.Errorf("%d chunks are missing from an identical file", len(missing))
+	}
+	missing := MissingChunks(have, want)
+	if len(missing) == 0 || len(missing) > 3 {
+		t.Fatalf("%d of %d chunks are missing after inserting bytes", len(missing), len(want))
+	}
+	// The missing chunks hold the inserted bytes
+	first, last := missing[0], missing[len(missing)-1]
+	if first.Offset > 50_000 || last.Offset+int64(last.Length) < 50_000+int64(len("inserted bytes")) {
+		t.Errorf("missing chunks cover bytes %d-%d, not the insertion", first.Offset, last.Offset+int64(last.Length))
+	}
+}
@@ -0,0 +1,160 @@
+package verify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Entry is a file or subdirectory in a [DirTree].
+// Root is the root hash of the file's tree, or of the
+// subdirectory's DirTree.
+type Entry struct {
+	Name string      `json:"name"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+	Root []byte      `json:"root"`
+
+	// Tree is the tree of a file, and Dir the tree of a
+	// subdirectory. Only one of them is set.
+	Tree *mtree.Tree `json:"-"`
+	Dir  *DirTree    `json:"-"`
+}
+
+// record returns the leaf data of the entry in its directory's tree.
+// It holds the length prefixed name, the size, the mode and the root.
+func (e Entry) record() []byte {
+	rec := binary.BigEndian.AppendUint32(nil, uint32(len(e.Name)))
+	rec = append(rec, e.Name...)
+	rec = binary.BigEndian.AppendUint64(rec, uint64(e.Size))
+	rec = binary.BigEndian.AppendUint32(rec, uint32(e.Mode))
+	return append(rec, e.Root...)
+}
+
+// DirTree identifies a whole directory by a single root. Each entry
+// is hashed into a record holding its name, size, mode and root, and
+// Tree is built over the records of all entries sorted by name.
+type DirTree struct {
+	Tree    *mtree.Tree
+	Entries []Entry
+}
+
+// RootHash returns the root hash of the directory.
+// The root of an empty directory is the hash of no data.
+func (d DirTree) RootHash() []byte {
+	return d.Tree.RootHash()
+}
+
+// HashDir hashes every file below the directory at path with
+// [HashFileHarr] and builds a [DirTree] over them, recursing into
+// subdirectories. Symbolic links and other special files are skipped.
+func HashDir(path string, splitSize int, opts ...Option) (*DirTree, error) {
+	o := newOptions(opts)
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := &DirTree{}
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+		entry := Entry{
+			Name: dirEntry.Name(),
+			Mode: info.Mode(),
+		}
+		entryPath := filepath.Join(path, entry.Name)
+		switch {
+		case info.IsDir():
+			if entry.Dir, err = HashDir(entryPath, splitSize, opts...); err != nil {
+				return nil, err
+			}
+			entry.Root = entry.Dir.RootHash()
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			if entry.Tree, err = HashFileHarr(entryPath, splitSize, opts...); err != nil {
+				return nil, err
+			}
+			entry.Root = entry.Tree.RootHash()
+		default:
+			continue
+		}
+		dir.Entries = append(dir.Entries, entry)
+	}
+	slices.SortFunc(dir.Entries, func(a, b Entry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	records := make([][]byte, len(dir.Entries))
+	for idx, entry := range dir.Entries {
+		records[idx] = o.hasher.Leaf(entry.record())
+	}
+	dir.Tree = mtree.FromLeafHashes(records, o.hasher)
+	return dir, nil
+}
+
+// EntryProof proves that Entry is part of a directory with a given root.
+type EntryProof struct {
+	Entry Entry        `json:"entry"`
+	Proof *mtree.Proof `json:"proof"`
+}
+
+// Prove returns a proof for every path component of the given slash
+// separated path, from the top-level directory down to the entry
+// itself. Together they prove the entry's root against the root of d,
+// see [VerifyPath]. The last proof holds the entry, including its tree.
+func (d *DirTree) Prove(path string) ([]EntryProof, error) {
+	var proofs []EntryProof
+	cur := d
+	names := strings.Split(strings.Trim(path, "/"), "/")
+	for depth, name := range names {
+		idx, found := slices.BinarySearchFunc(cur.Entries, name, func(e Entry, name string) int {
+			return strings.Compare(e.Name, name)
+		})
+		if !found {
+			return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+		}
+		proof, err := cur.Tree.Proof(idx)
+		if err != nil {
+			return nil, err
+		}
+		entry := cur.Entries[idx]
+		proofs = append(proofs, EntryProof{Entry: entry, Proof: proof})
+		if depth < len(names)-1 {
+			if entry.Dir == nil {
+				return nil, fmt.Errorf("%s: %s is not a directory", path, name)
+			}
+			cur = entry.Dir
+		}
+	}
+	return proofs, nil
+}
+
+// VerifyPath checks that proofs, as returned by [DirTree.Prove], prove
+// the entry at the given path against the trusted root of a directory.
+// The root of the proven entry is that of the last proof.
+func VerifyPath(h mtree.Hasher, root []byte, path string, proofs []EntryProof) bool {
+	names := strings.Split(strings.Trim(path, "/"), "/")
+	if len(proofs) != len(names) {
+		return false
+	}
+	for depth, p := range proofs {
+		if p.Entry.Name != names[depth] || p.Proof == nil {
+			return false
+		}
+		if depth < len(proofs)-1 && !p.Entry.Mode.IsDir() {
+			return false
+		}
+		if !h.VerifyProof(root, p.Entry.record(), p.Proof) {
+			return false
+		}
+		root = p.Entry.Root
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// writeTestDir creates a directory holding a file, an empty
+// file, a subdirectory with two files and a symbolic link.
+func writeTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"file":        merkletest.Data(5*testSplitSize + 3),
+		"empty":       nil,
+		"sub/first":   merkletest.Data(testSplitSize),
+		"sub/another": merkletest.Data(3 * testSplitSize),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestHashDir(t *testing.T) {
+	h := mtree.DomainSeparated
+	dir := writeTestDir(t)
+	tree, err := HashDir(dir, testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range tree.Entries {
+		names = append(names, entry.Name)
+	}
+	if got, want := names, []string{"empty", "file", "sub"}; !slices.Equal(got, want) {
+		t.Fatalf("entries are %q, want %q", got, want)
+	}
+	if tree.Tree.LeafCount() != 3 {
+		t.Errorf("tree has %d leaves, want one per entry", tree.Tree.LeafCount())
+	}
+
+	empty, file, sub := tree.Entries[0], tree.Entries[1], tree.Entries[2]
+	if !bytes.Equal(empty.Root, h.Empty()) || empty.Size != 0 {
+		t.Error("root of an empty file is not the hash of no data")
+	}
+	want, err := HashFileHarr(filepath.Join(dir, "file"), testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(file.Root, want.RootHash()) || file.Size != 5*testSplitSize+3 || file.Tree == nil {
+		t.Error("file entry does not hold the file's tree")
+	}
+	subTree, err := HashDir(filepath.Join(dir, "sub"), testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sub.Mode.IsDir() || sub.Dir == nil || !bytes.Equal(sub.Root, subTree.RootHash()) {
+		t.Error("subdirectory entry does not hold the subdirectory's tree")
+	}
+
+	// Changing a file below a subdirectory changes the root
+	if err := os.WriteFile(filepath.Join(dir, "sub", "first"), merkletest.Data(testSplitSize+1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := HashDir(dir, testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(changed.RootHash(), tree.RootHash()) {
+		t.Error("root did not change with the contents of a file")
+	}
+
+	emptyDir, err := HashDir(t.TempDir(), testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(emptyDir.RootHash(), h.Empty()) {
+		t.Error("root of an empty directory is not the hash of no data")
+	}
+}
+
+func TestProvePath(t *testing.T) {
+	h := mtree.DomainSeparated
+	tree, err := HashDir(writeTestDir(t), testSplitSize, WithHasher(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.RootHash()
+	for _, path := range []string{"empty", "file", "sub", "sub/first", "/sub/another"} {
+		proofs, err := tree.Prove(path)
+		if err != nil {
+			t.Fatalf("Prove(%q): %v", path, err)
+		}
+		if !VerifyPath(h, root, path, proofs) {
+			t.Errorf("proof of %q does not verify", path)
+		}
+		if VerifyPath(h, h.Empty(), path, proofs) {
+			t.Errorf("proof of %q verifies against the wrong root", path)
+		}
+		if VerifyPath(h, root, path+"x", proofs) {
+			t.Errorf("proof of %q verifies another path", path)
+		}
+		if VerifyPath(h, root, path, proofs[:len(proofs)-1]) {
+			t.Errorf("proof of %q verifies with a component missing", path)
+		}
+		last := &proofs[len(proofs)-1].Entry
+		last.Size++
+		if VerifyPath(h, root, path, proofs) {
+			t.Errorf("proof of %q verifies with the wrong size", path)
+		}
+	}
+
+	if _, err := tree.Prove("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Prove of a missing entry returned %v", err)
+	}
+	if _, err := tree.Prove("link"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Prove of a symbolic link returned %v", err)
+	}
+	if _, err := tree.Prove("file/first"); err == nil {
+		t.Error("Prove below a file succeeded")
+	}
+}
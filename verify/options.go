@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"runtime"
+
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+// Option configures how a file is hashed.
+type Option func(*options)
+
+type options struct {
+	hasher     mtree.Hasher
+	workers    int
+	queueDepth int
+	pool       bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		hasher:     mtree.Legacy,
+		workers:    runtime.NumCPU(),
+		queueDepth: 100,
+		pool:       true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithHasher sets the hasher used for leaves and interior nodes.
+// Defaults to [mtree.Legacy].
+func WithHasher(h mtree.Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithWorkers sets how many goroutines hash chunks concurrently in
+// [HashReaderAt] and [HashFileHarr]. Defaults to [runtime.NumCPU].
+// Values below 1 keep the default.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// WithQueueDepth sets how many chunks [HashReaderAt] and [HashFileHarr]
+// read ahead of the workers. Each queued chunk holds a buffer, so this
+// bounds the memory used for chunks. Defaults to 100. Values below 0
+// keep the default.
+func WithQueueDepth(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.queueDepth = n
+		}
+	}
+}
+
+// WithBufferPool sets whether [HashReaderAt] and [HashFileHarr] reuse
+// chunk buffers once they are hashed, instead of allocating a new one
+// for every chunk. Defaults to true.
+func WithBufferPool(enabled bool) Option {
+	return func(o *options) {
+		o.pool = enabled
+	}
+}
@@ -0,0 +1,165 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Solidsilver/merkle/hash"
+	"github.com/Solidsilver/merkle/mtree"
+	pb "github.com/schollz/progressbar/v3"
+)
+
+// HashReader hashes everything read from r until EOF
+// using typical tree insertion. The length of r does
+// not need to be known ahead of time, so this works
+// for stdin and network bodies. It produces the same
+// tree as [HashReaderAt] and [HashFileHarr].
+func HashReader(r io.Reader, splitSize int, opts ...Option) (*mtree.Tree, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	bt := mtree.NewEmpty()
+	bt.Hasher = o.hasher
+	bar := pb.NewOptions64(-1,
+		pb.OptionSetDescription("hashing"),
+		pb.OptionShowBytes(true),
+		pb.OptionShowElapsedTimeOnFinish(),
+	)
+
+	complete := false
+	chunk := make([]byte, splitSize)
+	reader := bufio.NewReaderSize(r, 8192)
+	for !complete {
+		bytesRead, err := io.ReadFull(reader, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			complete = true
+		} else if err != nil {
+			return nil, err
+		}
+		if bytesRead != 0 {
+			bt.AddData(chunk[:bytesRead])
+			bar.Add(bytesRead)
+			bt.Length += int64(bytesRead)
+		}
+	}
+	bt.ChunkSize = splitSize
+
+	return bt, nil
+}
+
+// HashReaderAt hashes the first size bytes of r by
+// assembling a list of leaves, then building the tree
+// from the leaves up. This uses up to a 1G read buffer.
+// It fails if r holds fewer than size bytes. Chunks are
+// hashed concurrently, see [WithWorkers], [WithQueueDepth]
+// and [WithBufferPool].
+func HashReaderAt(r io.ReaderAt, size int64, splitSize int, opts ...Option) (*mtree.Tree, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	harr := hash.NewHashArrayWith(int(math.Ceil(float64(size)/float64(splitSize))), o.hasher)
+	bar := pb.NewOptions64(size,
+		pb.OptionSetDescription("hashing"),
+		pb.OptionShowBytes(true),
+		pb.OptionShowElapsedTimeOnFinish(),
+		pb.OptionSetPredictTime(true),
+	)
+	readSize := GB_IN_BYTES
+	if size < int64(readSize) {
+		readSize = int(size)
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(r, 0, size), readSize)
+
+	var pool *hash.BufferPool
+	if o.pool {
+		pool = hash.NewBufferPool(splitSize)
+	}
+	complete := false
+	var totalRead int64
+	jobs := make(chan hash.HashJob, o.queueDepth)
+	var wg sync.WaitGroup
+
+	wg.Add(o.workers)
+	for range o.workers {
+		go hash.HashWorker(jobs, harr, &wg)
+	}
+	for !complete {
+		var chunk []byte
+		if pool != nil {
+			chunk = pool.Get()
+		} else {
+			chunk = make([]byte, splitSize)
+		}
+		bytesRead, err := io.ReadFull(reader, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			complete = true
+		} else if err != nil {
+			fmt.Println(err.Error())
+			close(jobs)
+			wg.Wait()
+			return nil, err
+		}
+		if bytesRead != 0 {
+			harr.QueuePooledHashInsert(chunk[:bytesRead], pool, jobs)
+			bar.Add(bytesRead)
+			totalRead += int64(bytesRead)
+		} else if pool != nil {
+			pool.Put(chunk)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if totalRead != size {
+		return nil, fmt.Errorf("read %d of %d bytes: %w", totalRead, size, io.ErrUnexpectedEOF)
+	}
+	fmt.Println()
+	bar = pb.NewOptions(-1,
+		pb.OptionSetDescription("Building tree"),
+	)
+	built := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-built:
+				fmt.Println("Done Building Tree")
+				return
+			case <-ticker.C:
+				bar.Add(1)
+			}
+		}
+	}()
+	bt := harr.BuildTree()
+	close(built)
+	bt.ChunkSize, bt.Length = splitSize, size
+
+	return bt, nil
+}
+
+// HashReaderStream computes the root hash of everything
+// read from r until EOF without building the tree,
+// using O(log n) memory. It produces the same root
+// as [HashReaderAt].
+func HashReaderStream(r io.Reader, splitSize int, opts ...Option) ([]byte, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	bar := pb.NewOptions64(-1,
+		pb.OptionSetDescription("hashing"),
+		pb.OptionShowBytes(true),
+		pb.OptionShowElapsedTimeOnFinish(),
+	)
+	stream := hash.NewStream(splitSize, o.hasher)
+	if _, err := io.Copy(io.MultiWriter(stream, bar), r); err != nil {
+		return nil, err
+	}
+	return stream.Sum(nil), nil
+}
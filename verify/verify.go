@@ -1,13 +1,20 @@
+// Package verify hashes files and readers into Merkle trees.
+//
+// Every strategy splits its input into chunks of splitSize bytes and
+// produces the same tree. The final chunk is hashed as is, so it may be
+// shorter than splitSize, and empty input has no leaves and the hash of
+// no data as its root (see [mtree.Hasher.Empty]). [HashFileCmp] checks
+// that the strategies agree. They all fail if splitSize is less than 1.
 package verify
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
-	"sync"
-	"time"
 
 	"github.com/Solidsilver/merkle/hash"
 	"github.com/Solidsilver/merkle/mtree"
@@ -16,10 +23,22 @@ import (
 
 const GB_IN_BYTES = 1073741824
 
+func checkSplitSize(splitSize int) error {
+	if splitSize < 1 {
+		return fmt.Errorf("invalid split size %d", splitSize)
+	}
+	return nil
+}
+
 // HashFile hashes file using typical tree insertion
 // It uses default file read buffer size
-func HashFile(path string, splitSize int) (*mtree.Tree, error) {
+func HashFile(path string, splitSize int, opts ...Option) (*mtree.Tree, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
 	bt := mtree.NewEmpty()
+	bt.Hasher = o.hasher
 
 	openFile, err := os.Open(path)
 	if err != nil {
@@ -43,23 +62,31 @@ func HashFile(path string, splitSize int) (*mtree.Tree, error) {
 	reader := bufio.NewReaderSize(openFile, 8192)
 	for !complete {
 		bytesRead, err := io.ReadFull(reader, chunk)
-		if err == io.EOF || bytesRead < splitSize {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			complete = true
-		} else if err != nil && err != io.EOF {
+		} else if err != nil {
 			fmt.Println(err.Error())
 			return nil, err
 		}
-		bt.AddData(chunk)
-		bar.Add(bytesRead)
+		if bytesRead != 0 {
+			bt.AddData(chunk[:bytesRead])
+			bar.Add(bytesRead)
+		}
 	}
+	bt.ChunkSize, bt.Length = splitSize, fileSize
 
 	return bt, nil
 }
 
 // HashFileLargeReadBuffer hashes file using typical tree insertion
 // It uses up to a 1G file read buffer size
-func HashFileLargeReadBuffer(path string, splitSize int) (*mtree.Tree, error) {
+func HashFileLargeReadBuffer(path string, splitSize int, opts ...Option) (*mtree.Tree, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
 	bt := mtree.NewEmpty()
+	bt.Hasher = o.hasher
 
 	openFile, err := os.Open(path)
 	if err != nil {
@@ -88,17 +115,18 @@ func HashFileLargeReadBuffer(path string, splitSize int) (*mtree.Tree, error) {
 	reader := bufio.NewReaderSize(openFile, readSize)
 	for !complete {
 		bytesRead, err := io.ReadFull(reader, chunk)
-		if err == io.EOF || bytesRead < splitSize {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			complete = true
-		} else if err != nil && err != io.EOF {
+		} else if err != nil {
 			fmt.Println(err.Error())
 			return nil, err
 		}
 		if bytesRead != 0 {
-			bt.AddData(chunk)
+			bt.AddData(chunk[:bytesRead])
 			bar.Add(bytesRead)
 		}
 	}
+	bt.ChunkSize, bt.Length = splitSize, fileSize
 
 	return bt, nil
 }
@@ -107,7 +135,7 @@ func HashFileLargeReadBuffer(path string, splitSize int) (*mtree.Tree, error) {
 // leaves, then building the tree from
 // the leaves up. This uses up to a 1G
 // file read buffer.
-func HashFileHarr(path string, splitSize int) (*mtree.Tree, error) {
+func HashFileHarr(path string, splitSize int, opts ...Option) (*mtree.Tree, error) {
 	openFile, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -117,82 +145,27 @@ func HashFileHarr(path string, splitSize int) (*mtree.Tree, error) {
 	if err != nil {
 		return nil, err
 	}
-	fileSize := stat.Size()
-	harr := hash.NewHashArray(int(math.Ceil(float64(fileSize) / float64(splitSize))))
-	bar := pb.NewOptions64(fileSize,
-		pb.OptionSetDescription("hashing"),
-		pb.OptionShowBytes(true),
-		pb.OptionShowElapsedTimeOnFinish(),
-		pb.OptionSetPredictTime(true),
-	)
-	readSize := GB_IN_BYTES
-	if fileSize < int64(readSize) {
-		readSize = int(fileSize)
-	}
-	reader := bufio.NewReaderSize(openFile, readSize)
-
-	complete := false
-	jobs := make(chan hash.HashJob, 100)
-	var wg sync.WaitGroup
-
-	workers := 3
-	wg.Add(workers)
-	for range workers {
-		go hash.HashWorker(jobs, harr, &wg)
-	}
-	for !complete {
-		chunk := make([]byte, splitSize)
-		bytesRead, err := io.ReadFull(reader, chunk)
-		if err == io.EOF || bytesRead < splitSize {
-			complete = true
-		} else if err != nil {
-			fmt.Println(err.Error())
-			return nil, err
-		}
-		if bytesRead != 0 {
-			harr.QueueHashInsert(chunk, jobs)
-			bar.Add(bytesRead)
-		}
-	}
-	close(jobs)
-	wg.Wait()
-	fmt.Println()
-	bar = pb.NewOptions(-1,
-		pb.OptionSetDescription("Building tree"),
-	)
-	isLoading := true
-	go func() {
-		for isLoading {
-			bar.Add(1)
-			time.Sleep(50 * time.Millisecond)
-		}
-		fmt.Println("Done Building Tree")
-	}()
-	bt := harr.BuildTree()
-	isLoading = false
-
-	return bt, nil
+	return HashReaderAt(openFile, stat.Size(), splitSize, opts...)
 }
 
-// HashFileCmp is a debug function
-// to compare outputs of multiple
-// hash techniques.
-func HashFileCmp(path string, splitSize int) error {
+// HashFileStream computes the root hash of a file
+// without building the tree, using O(log n) memory.
+// It produces the same root as [HashFileHarr].
+func HashFileStream(path string, splitSize int, opts ...Option) ([]byte, error) {
+	if err := checkSplitSize(splitSize); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
 	openFile, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer openFile.Close()
 	stat, err := openFile.Stat()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	iterBuiltTree := mtree.NewEmpty()
 	fileSize := stat.Size()
-	fmt.Printf("File size is %d bytes\n", fileSize)
-	harrSize := int(math.Ceil(float64(fileSize) / float64(splitSize)))
-	fmt.Printf("harrSize is %d\n", harrSize)
-	harr := hash.NewHashArray(harrSize)
 	bar := pb.NewOptions64(fileSize,
 		pb.OptionSetDescription("hashing"),
 		pb.OptionShowBytes(true),
@@ -205,34 +178,62 @@ func HashFileCmp(path string, splitSize int) error {
 	}
 	reader := bufio.NewReaderSize(openFile, readSize)
 
-	complete := false
-	jobs := make(chan hash.HashJob, 100)
-	var wg sync.WaitGroup
+	stream := hash.NewStream(splitSize, o.hasher)
+	if _, err := io.Copy(io.MultiWriter(stream, bar), reader); err != nil {
+		return nil, err
+	}
+	return stream.Sum(nil), nil
+}
 
-	workers := 3
-	wg.Add(workers)
-	for range workers {
-		go hash.HashWorker(jobs, harr, &wg)
+// HashFileCmp hashes a file with every strategy in this package and
+// returns an error naming each one whose root differs from
+// [HashFileHarr]. It checks that all strategies agree on how the final
+// partial chunk and empty files are hashed.
+func HashFileCmp(path string, splitSize int, opts ...Option) error {
+	control, err := HashFileHarr(path, splitSize, opts...)
+	if err != nil {
+		return err
 	}
-	for !complete {
-		chunk := make([]byte, splitSize)
-		bytesRead, err := io.ReadFull(reader, chunk)
-		if err == io.EOF || bytesRead < splitSize {
-			complete = true
-		} else if err != nil {
-			fmt.Println(err.Error())
-			return err
+	rootOf := func(tree *mtree.Tree, err error) ([]byte, error) {
+		if err != nil {
+			return nil, err
 		}
-		if bytesRead != 0 {
-			harr.QueueHashInsert(chunk, jobs)
-			iterBuiltTree.AddData(chunk)
-			bar.Add(bytesRead)
+		if !bytes.Equal(tree.RootHash(), control.RootHash()) {
+			mtree.CompareTrees(control, tree)
+		}
+		return tree.RootHash(), nil
+	}
+	strategies := []struct {
+		name string
+		root func() ([]byte, error)
+	}{
+		{"HashFile", func() ([]byte, error) {
+			return rootOf(HashFile(path, splitSize, opts...))
+		}},
+		{"HashFileLargeReadBuffer", func() ([]byte, error) {
+			return rootOf(HashFileLargeReadBuffer(path, splitSize, opts...))
+		}},
+		{"HashReader", func() ([]byte, error) {
+			openFile, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer openFile.Close()
+			return rootOf(HashReader(openFile, splitSize, opts...))
+		}},
+		{"HashFileStream", func() ([]byte, error) {
+			return HashFileStream(path, splitSize, opts...)
+		}},
+	}
+	var errs []error
+	for _, strategy := range strategies {
+		root, err := strategy.root()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", strategy.name, err))
+		} else if !bytes.Equal(root, control.RootHash()) {
+			errs = append(errs, fmt.Errorf("%s: root %s does not match HashFileHarr root %s", strategy.name,
+				base64.RawStdEncoding.EncodeToString(root), base64.RawStdEncoding.EncodeToString(control.RootHash())))
 		}
 	}
-	close(jobs)
-	wg.Wait()
-	harrBuiltTree := harr.BuildTree()
-	mtree.CompareTrees(harrBuiltTree, iterBuiltTree)
-
-	return nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,175 @@
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Solidsilver/merkle/internal/merkletest"
+	"github.com/Solidsilver/merkle/mtree"
+)
+
+const testSplitSize = 64
+
+// writeTestFile writes size bytes to a new file and returns its path and data.
+func writeTestFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := merkletest.Data(size)
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// rootOf returns the root hash of a tree returned with err.
+func rootOf(tree *mtree.Tree, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return tree.RootHash(), nil
+}
+
+// TestStrategiesAgree checks that every hashing strategy produces the
+// same root, including for a short final chunk and for empty files.
+func TestStrategiesAgree(t *testing.T) {
+	for _, h := range []mtree.Hasher{mtree.Legacy, mtree.DomainSeparated} {
+		opt := WithHasher(h)
+		for _, size := range merkletest.Sizes(testSplitSize) {
+			path, data := writeTestFile(t, size)
+			want := merkletest.Tree(h, data, testSplitSize).RootHash()
+			strategies := []struct {
+				name string
+				root func() ([]byte, error)
+			}{
+				{"HashFile", func() ([]byte, error) { return rootOf(HashFile(path, testSplitSize, opt)) }},
+				{"HashFileLargeReadBuffer", func() ([]byte, error) { return rootOf(HashFileLargeReadBuffer(path, testSplitSize, opt)) }},
+				{"HashFileHarr", func() ([]byte, error) { return rootOf(HashFileHarr(path, testSplitSize, opt)) }},
+				{"HashFileHarr with one worker", func() ([]byte, error) {
+					return rootOf(HashFileHarr(path, testSplitSize, opt, WithWorkers(1), WithQueueDepth(1)))
+				}},
+				{"HashFileStream", func() ([]byte, error) { return HashFileStream(path, testSplitSize, opt) }},
+				{"HashReader", func() ([]byte, error) { return rootOf(HashReader(bytes.NewReader(data), testSplitSize, opt)) }},
+				{"HashReaderAt", func() ([]byte, error) {
+					return rootOf(HashReaderAt(bytes.NewReader(data), int64(size), testSplitSize, opt))
+				}},
+				{"HashReaderAt without pooling", func() ([]byte, error) {
+					return rootOf(HashReaderAt(bytes.NewReader(data), int64(size), testSplitSize, opt,
+						WithWorkers(1), WithQueueDepth(0), WithBufferPool(false)))
+				}},
+				{"HashReaderStream", func() ([]byte, error) { return HashReaderStream(bytes.NewReader(data), testSplitSize, opt) }},
+			}
+			for _, strategy := range strategies {
+				root, err := strategy.root()
+				if err != nil {
+					t.Errorf("%s of %d bytes: %v", strategy.name, size, err)
+				} else if !bytes.Equal(root, want) {
+					t.Errorf("%v, %s of %d bytes: root differs from Tree", h, strategy.name, size)
+				}
+			}
+			if err := HashFileCmp(path, testSplitSize, opt); err != nil {
+				t.Errorf("HashFileCmp of %d bytes: %v", size, err)
+			}
+		}
+	}
+}
+
+func TestHashReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(merkletest.Data(3*testSplitSize)), iotest.ErrReader(errRead))
+	if _, err := HashReader(r, testSplitSize); !errors.Is(err, errRead) {
+		t.Errorf("HashReader returned %v, want the read error", err)
+	}
+	r = io.MultiReader(bytes.NewReader(merkletest.Data(3*testSplitSize)), iotest.ErrReader(errRead))
+	if _, err := HashReaderStream(r, testSplitSize); !errors.Is(err, errRead) {
+		t.Errorf("HashReaderStream returned %v, want the read error", err)
+	}
+	data := merkletest.Data(3 * testSplitSize)
+	if _, err := HashReaderAt(errReaderAt{bytes.NewReader(data), errRead}, 5*testSplitSize, testSplitSize); !errors.Is(err, errRead) {
+		t.Errorf("HashReaderAt returned %v, want the read error", err)
+	}
+	if _, err := HashReaderAt(bytes.NewReader(data), 5*testSplitSize, testSplitSize); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("HashReaderAt of a truncated reader returned %v", err)
+	}
+}
+
+func TestInvalidSplitSize(t *testing.T) {
+	path, data := writeTestFile(t, 3*testSplitSize)
+	for _, splitSize := range []int{0, -1} {
+		strategies := map[string]func() error{
+			"HashFile": func() error { _, err := HashFile(path, splitSize); return err },
+			"HashFileLargeReadBuffer": func() error {
+				_, err := HashFileLargeReadBuffer(path, splitSize)
+				return err
+			},
+			"HashFileHarr":     func() error { _, err := HashFileHarr(path, splitSize); return err },
+			"HashFileStream":   func() error { _, err := HashFileStream(path, splitSize); return err },
+			"HashReader":       func() error { _, err := HashReader(bytes.NewReader(data), splitSize); return err },
+			"HashReaderStream": func() error { _, err := HashReaderStream(bytes.NewReader(data), splitSize); return err },
+			"HashReaderAt": func() error {
+				_, err := HashReaderAt(bytes.NewReader(data), int64(len(data)), splitSize)
+				return err
+			},
+		}
+		for name, hash := range strategies {
+			if err := hash(); err == nil {
+				t.Errorf("%s with split size %d succeeded", name, splitSize)
+			}
+		}
+	}
+}
+
+func TestHashFileReadError(t *testing.T) {
+	// Reading a directory fails after it was opened
+	dir := t.TempDir()
+	if _, err := HashFile(dir, testSplitSize); err == nil {
+		t.Error("HashFile of a directory succeeded")
+	}
+	if _, err := HashFileLargeReadBuffer(dir, testSplitSize); err == nil {
+		t.Error("HashFileLargeReadBuffer of a directory succeeded")
+	}
+}
+
+// errReaderAt reads from r and returns err once r is exhausted.
+type errReaderAt struct {
+	r   io.ReaderAt
+	err error
+}
+
+func (e errReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := e.r.ReadAt(p, off)
+	if err == io.EOF {
+		err = e.err
+	}
+	return n, err
+}
+
+func TestTreeRecordsSize(t *testing.T) {
+	size := 3*testSplitSize + 1
+	path, data := writeTestFile(t, size)
+	hashers := []struct {
+		name string
+		hash func() (*mtree.Tree, error)
+	}{
+		{"HashFile", func() (*mtree.Tree, error) { return HashFile(path, testSplitSize) }},
+		{"HashFileHarr", func() (*mtree.Tree, error) { return HashFileHarr(path, testSplitSize) }},
+		{"HashFileLargeReadBuffer", func() (*mtree.Tree, error) { return HashFileLargeReadBuffer(path, testSplitSize) }},
+		{"HashReader", func() (*mtree.Tree, error) { return HashReader(bytes.NewReader(data), testSplitSize) }},
+		{"HashReaderAt", func() (*mtree.Tree, error) {
+			return HashReaderAt(bytes.NewReader(data), int64(size), testSplitSize)
+		}},
+	}
+	for _, hasher := range hashers {
+		tree, err := hasher.hash()
+		if err != nil {
+			t.Fatalf("%s: %v", hasher.name, err)
+		}
+		if tree.ChunkSize != testSplitSize || tree.Length != int64(size) || tree.LeafCount() != 4 {
+			t.Errorf("%s: tree has ChunkSize %d, Length %d and %d leaves", hasher.name, tree.ChunkSize, tree.Length, tree.LeafCount())
+		}
+	}
+}